@@ -19,7 +19,10 @@ import (
 	"github.com/thetatoken/vault/faucet"
 	"github.com/thetatoken/vault/handler"
 	"github.com/thetatoken/vault/keymanager"
+	"github.com/thetatoken/vault/lightclient"
+	"github.com/thetatoken/vault/quota"
 	"github.com/thetatoken/vault/util"
+	"github.com/thetatoken/vault/ws"
 	rpcc "github.com/ybbus/jsonrpc"
 	"golang.org/x/net/netutil"
 )
@@ -53,6 +56,7 @@ func decompressMiddleware(handler http.Handler) http.Handler {
 
 func startServer(da *db.DAO) {
 	logger := log.WithFields(log.Fields{"method": "rpc.startServer"})
+	viper.SetDefault("TrustNode", true)
 
 	s := rpc.NewServer()
 	s.RegisterCodec(json.NewCodec(), "application/json")
@@ -65,13 +69,48 @@ func startServer(da *db.DAO) {
 	}
 	defer keyManager.Close()
 
-	handler := handler.NewRPCHandler(client, keyManager)
-	s.RegisterService(handler, "theta")
+	signer, err := handler.NewSignerFromConfig(keyManager)
+	if err != nil {
+		logger.Fatalf("Failed to set up signer backend: %v", err)
+	}
+	if err := signer.HealthCheck(); err != nil {
+		logger.WithError(err).Warn("Signer backend health check failed at startup")
+	}
+
+	var store quota.Store
+	if redisAddr := viper.GetString("RedisAddr"); redisAddr != "" {
+		store = quota.NewRedisStore(redisAddr, viper.GetString("RedisPassword"), viper.GetInt("RedisDB"))
+	} else {
+		store = quota.NewMemoryStore()
+	}
+	limiter := quota.NewLimiterFromConfig(store)
+	metrics := quota.NewMetrics()
+
+	var rpcHandler *handler.ThetaRPCHandler
+	if viper.GetBool("TrustNode") {
+		rpcHandler = handler.NewRPCHandlerWithSigner(client, keyManager, signer)
+	} else {
+		verifier, err := lightclient.NewVerifier(client)
+		if err != nil {
+			logger.Fatalf("Failed to bootstrap light client: %v", err)
+		}
+		logger.Info("Running with TrustNode=false; verifying proofs locally")
+		rpcHandler = handler.NewVerifiedRPCHandler(client, keyManager, verifier, signer)
+	}
+	rpcHandler = rpcHandler.WithLimiter(limiter)
+	s.RegisterService(rpcHandler, "theta")
 	r := mux.NewRouter()
 	r.Use(util.LoggerMiddleware)
 	r.Use(decompressMiddleware)
+	r.Use(quota.Middleware(limiter, metrics))
 	r.Handle("/rpc", s)
 
+	upstreamWSAddr := viper.GetString("UpstreamWSAddr")
+	if upstreamWSAddr == "" {
+		upstreamWSAddr = "ws://localhost:16888/websocket"
+	}
+	r.Handle("/ws", ws.NewServer(keyManager, limiter, upstreamWSAddr))
+
 	port := viper.GetString("RPCPort")
 	l, err := net.Listen("tcp", ":"+port)
 	if err != nil {
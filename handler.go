@@ -0,0 +1,307 @@
+package vault
+
+import (
+	"encoding/hex"
+	"net/http"
+
+	json2 "github.com/gorilla/rpc/v2/json2"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	cmd "github.com/thetatoken/theta/cmd/thetacli/commands"
+	theta "github.com/thetatoken/theta/rpc"
+	"github.com/thetatoken/theta/types"
+	rpcc "github.com/ybbus/jsonrpc"
+
+	"github.com/thetatoken/vault/lightclient"
+	"github.com/thetatoken/vault/quota"
+)
+
+// ErrProofVerificationFailed is surfaced to JSON-RPC clients as a distinct
+// error code so they can tell a failed light-client verification apart
+// from an ordinary upstream RPC error.
+const ErrProofVerificationFailed = -32050
+
+// ThetaRPCHandler is the gorilla/rpc service registered under the "theta"
+// prefix. It brokers between the public JSON-RPC surface and the upstream
+// theta node, signing transactions with keys held by the KeyManager. When
+// verifier is non-nil, read methods verify the upstream response locally
+// instead of trusting it outright (TrustNode=false).
+type ThetaRPCHandler struct {
+	rpc      rpcc.RPCClient
+	km       KeyManager
+	logger   *log.Entry
+	verifier *lightclient.Verifier
+	signer   Signer
+	limiter  *quota.Limiter
+}
+
+func NewRPCHandler(rpc rpcc.RPCClient, km KeyManager) *ThetaRPCHandler {
+	return &ThetaRPCHandler{rpc, km, log.WithFields(log.Fields{"component": "handler"}), nil, NewSQLSigner(km), nil}
+}
+
+// NewVerifiedRPCHandler is NewRPCHandlerWithSigner for TrustNode=false:
+// every read response is checked against verifier before being returned.
+func NewVerifiedRPCHandler(rpc rpcc.RPCClient, km KeyManager, verifier *lightclient.Verifier, signer Signer) *ThetaRPCHandler {
+	return &ThetaRPCHandler{rpc, km, log.WithFields(log.Fields{"component": "handler"}), verifier, signer, nil}
+}
+
+// NewRPCHandlerWithSigner lets the caller pick a non-default Signer backend
+// (see NewSignerFromConfig), e.g. an HSM or KMS, instead of signing with
+// keys out of SqlKeyManager directly.
+func NewRPCHandlerWithSigner(rpc rpcc.RPCClient, km KeyManager, signer Signer) *ThetaRPCHandler {
+	return &ThetaRPCHandler{rpc, km, log.WithFields(log.Fields{"component": "handler"}), nil, signer, nil}
+}
+
+// WithLimiter attaches a quota.Limiter so Send enforces a daily coin cap
+// and theta.Quota can report a user's remaining budget. Without it, Send
+// is unmetered (the requests/sec limit still applies via quota.Middleware).
+func (h *ThetaRPCHandler) WithLimiter(limiter *quota.Limiter) *ThetaRPCHandler {
+	h.limiter = limiter
+	return h
+}
+
+// HealthCheckArgs is empty: the health check always exercises the
+// configured signer end to end rather than accepting caller-chosen input.
+type HealthCheckArgs struct{}
+
+type HealthCheckResult struct {
+	OK bool `json:"ok"`
+}
+
+// HealthCheck verifies the configured Signer backend can actually produce a
+// signature, so operators can alert on a dead KMS/HSM connection before a
+// user's Send call fails.
+func (h *ThetaRPCHandler) HealthCheck(r *http.Request, args *HealthCheckArgs, result *HealthCheckResult) error {
+	if err := h.signer.HealthCheck(); err != nil {
+		h.logger.WithError(err).Error("Signer health check failed")
+		return err
+	}
+	result.OK = true
+	return nil
+}
+
+type GetAccountArgs struct{}
+
+type SendArgs struct {
+	To       []types.TxOutput
+	Sequence int
+	Fee      types.Coin
+	Gas      int64
+}
+
+func (h *ThetaRPCHandler) GetAccount(r *http.Request, args *GetAccountArgs, result *theta.GetAccountResult) error {
+	userID := r.Header.Get("X-Auth-User")
+	record, err := h.km.FindByUserId(userID)
+	if err != nil {
+		h.logger.WithError(err).WithField("userid", userID).Error("Failed to look up key")
+		return err
+	}
+
+	if h.verifier == nil {
+		resp, err := h.rpc.Call("theta.GetAccount", theta.GetAccountArgs{Address: record.Address})
+		if err != nil {
+			h.logger.WithError(err).Error("Failed to call theta.GetAccount")
+			return err
+		}
+		if resp.Error != nil {
+			return resp.Error
+		}
+		return resp.GetObject(result)
+	}
+
+	return h.getVerifiedAccount(record.Address, result)
+}
+
+// getVerifiedAccount asks the upstream node for the account together with
+// its IAVL proof and enclosing commit, then verifies both locally before
+// trusting the result, instead of forwarding the node's answer as-is.
+func (h *ThetaRPCHandler) getVerifiedAccount(address string, result *theta.GetAccountResult) error {
+	resp, err := h.rpc.Call("theta.GetAccount", theta.GetAccountArgs{Address: address, IncludeProof: true})
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to call theta.GetAccount")
+		return err
+	}
+	if resp.Error != nil {
+		return resp.Error
+	}
+
+	var proved struct {
+		theta.GetAccountResult
+		Height int64                     `json:"height"`
+		Proof  lightclient.AccountProof  `json:"proof"`
+	}
+	if err := resp.GetObject(&proved); err != nil {
+		return err
+	}
+
+	if err := h.verifier.VerifyAccountProof(address, proved.Account, proved.Height, &proved.Proof); err != nil {
+		h.logger.WithError(err).WithField("address", address).Error("Account proof verification failed")
+		if _, ok := err.(lightclient.ErrProofVerification); ok {
+			return &json2.Error{Code: ErrProofVerificationFailed, Message: err.Error()}
+		}
+		return err
+	}
+
+	*result = proved.GetAccountResult
+	return nil
+}
+
+type ExportMnemonicArgs struct {
+	Passphrase string
+}
+
+type ExportMnemonicResult struct {
+	Mnemonic string `json:"mnemonic"`
+}
+
+// ExportMnemonic returns the caller's master seed phrase, so a hosted user
+// can restore their wallet independently of the vault.
+func (h *ThetaRPCHandler) ExportMnemonic(r *http.Request, args *ExportMnemonicArgs, result *ExportMnemonicResult) error {
+	userID := r.Header.Get("X-Auth-User")
+	mnemonic, err := h.km.ExportMnemonic(userID, args.Passphrase)
+	if err != nil {
+		h.logger.WithError(err).WithField("userid", userID).Error("Failed to export mnemonic")
+		return err
+	}
+	result.Mnemonic = mnemonic
+	return nil
+}
+
+type ImportMnemonicArgs struct {
+	Words      []string
+	Passphrase string
+}
+
+type ImportMnemonicResult struct {
+	Address string `json:"address"`
+}
+
+// ImportMnemonic restores the caller's master key from a previously
+// exported seed phrase, overwriting whatever key is currently stored.
+func (h *ThetaRPCHandler) ImportMnemonic(r *http.Request, args *ImportMnemonicArgs, result *ImportMnemonicResult) error {
+	userID := r.Header.Get("X-Auth-User")
+	if err := h.km.ImportMnemonic(userID, args.Words, args.Passphrase); err != nil {
+		h.logger.WithError(err).WithField("userid", userID).Error("Failed to import mnemonic")
+		return err
+	}
+	record, err := h.km.FindByUserId(userID)
+	if err != nil {
+		return err
+	}
+	result.Address = record.Address
+	return nil
+}
+
+type DeriveSubaccountArgs struct {
+	Passphrase string
+	Path       string
+}
+
+type DeriveSubaccountResult struct {
+	Address string `json:"address"`
+	Path    string `json:"path"`
+}
+
+// DeriveSubaccount derives (and persists) a child key at args.Path under
+// the caller's master key, giving hosted users self-custody-grade
+// recoverability for any number of subaccounts.
+func (h *ThetaRPCHandler) DeriveSubaccount(r *http.Request, args *DeriveSubaccountArgs, result *DeriveSubaccountResult) error {
+	userID := r.Header.Get("X-Auth-User")
+	record, err := h.km.DeriveSubaccount(userID, args.Passphrase, args.Path)
+	if err != nil {
+		h.logger.WithError(err).WithField("userid", userID).WithField("path", args.Path).Error("Failed to derive subaccount")
+		return err
+	}
+	result.Address = record.Address
+	result.Path = args.Path
+	return nil
+}
+
+type QuotaArgs struct{}
+
+// Quota lets a client check its remaining throttling budget before it gets
+// rejected, rather than discovering the limit by hitting it.
+func (h *ThetaRPCHandler) Quota(r *http.Request, args *QuotaArgs, result *quota.Budget) error {
+	if h.limiter == nil {
+		return nil
+	}
+	userID := r.Header.Get("X-Auth-User")
+	*result = h.limiter.Budget(userID)
+	return nil
+}
+
+// Send signs and broadcasts a SendTx on behalf of the caller. Signing goes
+// through the configured Signer backend so the private key material never
+// has to pass through this handler; only a signature and public key come
+// back. The caller's passphrase (X-Auth-Passphrase) is forwarded to the
+// signer, which backends that don't need one (KMS, PKCS#11) simply ignore.
+func (h *ThetaRPCHandler) Send(r *http.Request, args *SendArgs, result *theta.BroadcastRawTransactionResult) error {
+	userID := r.Header.Get("X-Auth-User")
+	passphrase := r.Header.Get("X-Auth-Passphrase")
+
+	record, err := h.km.FindByUserId(userID)
+	if err != nil {
+		h.logger.WithError(err).WithField("userid", userID).Error("Failed to look up key")
+		return err
+	}
+
+	fromAddress, err := hex.DecodeString(record.Address)
+	if err != nil {
+		return err
+	}
+
+	var inputCoins types.Coins
+	for _, out := range args.To {
+		inputCoins = inputCoins.Plus(out.Coins)
+	}
+
+	if h.limiter != nil {
+		for _, coin := range inputCoins {
+			if coin.Denom != "ThetaWei" {
+				continue
+			}
+			if !h.limiter.AllowSend(userID, coin.Amount) {
+				h.logger.WithField("userid", userID).Warn("Rejected Send over daily coin cap")
+				return quota.RPCError{Code: quota.ErrDailyCoinCapExceeded, Message: "daily coin cap exceeded"}
+			}
+		}
+	}
+
+	sendTx := &cmd.SendTx{
+		Tx: &types.SendTx{
+			Outputs: args.To,
+			Inputs: []types.TxInput{{
+				Address:  fromAddress,
+				Sequence: args.Sequence,
+				Coins:    inputCoins,
+			}},
+			Fee: args.Fee,
+			Gas: args.Gas,
+		},
+	}
+	sendTx.SetChainID(viper.GetString("ChainID"))
+	sendTx.AddSigner(record.PubKey)
+
+	sig, pubKey, err := h.signer.Sign(userID, passphrase, sendTx.SignBytes())
+	if err != nil {
+		h.logger.WithError(err).WithField("userid", userID).Error("Failed to sign transaction")
+		return err
+	}
+	if err := sendTx.Sign(pubKey, sig); err != nil {
+		return err
+	}
+	txBytes, err := sendTx.TxBytes()
+	if err != nil {
+		return err
+	}
+
+	resp, err := h.rpc.Call("theta.BroadcastRawTransaction", &theta.BroadcastRawTransactionArgs{TxBytes: hex.EncodeToString(txBytes)})
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to call theta.BroadcastRawTransaction")
+		return err
+	}
+	if resp.Error != nil {
+		return resp.Error
+	}
+	return resp.GetObject(result)
+}
@@ -17,6 +17,8 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+
+	"github.com/thetatoken/vault/quota"
 )
 
 var logger = log.WithFields(log.Fields{"component": "server"})
@@ -55,7 +57,7 @@ func TestGetAccount(t *testing.T) {
 	// Should return account successfully.
 	mockRPC = &MockRPCClient{}
 	mockKeyManager = &MockKeyManager{}
-	handler = &ThetaRPCHandler{mockRPC, mockKeyManager, logger}
+	handler = &ThetaRPCHandler{mockRPC, mockKeyManager, logger, nil, NewSQLSigner(mockKeyManager), nil}
 	mockKeyManager.
 		On("FindByUserId", "alice").
 		Return(getRecord(), nil)
@@ -73,7 +75,7 @@ func TestGetAccount(t *testing.T) {
 	// Should return error when RPC call fail
 	mockRPC = &MockRPCClient{}
 	mockKeyManager = &MockKeyManager{}
-	handler = &ThetaRPCHandler{mockRPC, mockKeyManager, logger}
+	handler = &ThetaRPCHandler{mockRPC, mockKeyManager, logger, nil, NewSQLSigner(mockKeyManager), nil}
 	mockKeyManager.
 		On("FindByUserId", "alice").
 		Return(getRecord(), nil)
@@ -89,7 +91,7 @@ func TestGetAccount(t *testing.T) {
 	// Should return error when key manager fail
 	mockRPC = &MockRPCClient{}
 	mockKeyManager = &MockKeyManager{}
-	handler = &ThetaRPCHandler{mockRPC, mockKeyManager, logger}
+	handler = &ThetaRPCHandler{mockRPC, mockKeyManager, logger, nil, NewSQLSigner(mockKeyManager), nil}
 	mockKeyManager.
 		On("FindByUserId", "alice").
 		Return(Record{}, errors.New("key manager error"))
@@ -152,10 +154,13 @@ func TestSend(t *testing.T) {
 	// Should send successfully.
 	mockRPC = &MockRPCClient{}
 	mockKeyManager = &MockKeyManager{}
-	handler = &ThetaRPCHandler{mockRPC, mockKeyManager, logger}
+	handler = &ThetaRPCHandler{mockRPC, mockKeyManager, logger, nil, NewSQLSigner(mockKeyManager), nil}
 	mockKeyManager.
 		On("FindByUserId", "alice").
 		Return(getRecord(), nil)
+	mockKeyManager.
+		On("Unlock", "alice", "correct horse battery staple").
+		Return(getRecord(), nil)
 	expectedTxBytes := "12c7010805120c0a0847616d6d6157656910041a8e010a142674ae64cb5206b2afc6b6fbd0e5a65c025b5016120c0a085468657461576569107b1801224212406c6dbdf253f520028743823c395cdb03dbf7ed399a8e6b251b5ac11d2ee1cb52c92380474884d281933288b7e7249954c8d595c94d85c19d9083c4307b811a062a221220355897db094c7aac8242e0bce8ae6a4db8b6c08b38bed3290ea3560a6515cc3b22240a14efee576f3d668674bc73e007f6abfa243311bd37120c0a085468657461576569107b"
 	resp := theta.BroadcastRawTransactionResult{&core_types.ResultBroadcastTxCommit{Height: 123}}
 	mockRPC.
@@ -175,6 +180,7 @@ func TestSend(t *testing.T) {
 	result = &theta.BroadcastRawTransactionResult{}
 	req, _ := http.NewRequest("", "", bytes.NewBufferString(""))
 	req.Header.Add("X-Auth-User", "alice")
+	req.Header.Add("X-Auth-Passphrase", "correct horse battery staple")
 	err = handler.Send(req, args, result)
 	assert.Equal(123, result.Height)
 	assert.Nil(err)
@@ -183,10 +189,13 @@ func TestSend(t *testing.T) {
 	// Should pass the error if RPC calls has error.
 	mockRPC = &MockRPCClient{}
 	mockKeyManager = &MockKeyManager{}
-	handler = &ThetaRPCHandler{mockRPC, mockKeyManager, logger}
+	handler = &ThetaRPCHandler{mockRPC, mockKeyManager, logger, nil, NewSQLSigner(mockKeyManager), nil}
 	mockKeyManager.
 		On("FindByUserId", "alice").
 		Return(getRecord(), nil)
+	mockKeyManager.
+		On("Unlock", "alice", "correct horse battery staple").
+		Return(getRecord(), nil)
 	mockRPC.
 		On("Call", "theta.BroadcastRawTransaction", &theta.BroadcastRawTransactionArgs{TxBytes: expectedTxBytes}).
 		Return(&rpcc.RPCResponse{Error: &rpcc.RPCError{Code: 3000, Message: "Failed."}}, nil).Once()
@@ -204,9 +213,56 @@ func TestSend(t *testing.T) {
 	result = &theta.BroadcastRawTransactionResult{}
 	req, _ = http.NewRequest("", "", bytes.NewBufferString(""))
 	req.Header.Add("X-Auth-User", "alice")
+	req.Header.Add("X-Auth-Passphrase", "correct horse battery staple")
 	err = handler.Send(req, args, result)
 	assert.NotNil(err)
 	assert.Equal("3000: Failed.", err.Error())
 	mockRPC.AssertExpectations(t)
 
 }
+
+func TestQuota(t *testing.T) {
+	assert := assert.New(t)
+
+	mockRPC := &MockRPCClient{}
+	mockKeyManager := &MockKeyManager{}
+	limiter := quota.NewLimiterFromConfig(quota.NewMemoryStore())
+	handler := (&ThetaRPCHandler{mockRPC, mockKeyManager, logger, nil, NewSQLSigner(mockKeyManager), nil}).WithLimiter(limiter)
+
+	result := &quota.Budget{}
+	req, _ := http.NewRequest("", "", bytes.NewBufferString(""))
+	req.Header.Add("X-Auth-User", "alice")
+	err := handler.Quota(req, &QuotaArgs{}, result)
+	assert.Nil(err)
+	assert.True(result.RemainingBurst > 0)
+}
+
+func TestSendRequiresPassphrase(t *testing.T) {
+	assert := assert.New(t)
+
+	mockRPC := &MockRPCClient{}
+	mockKeyManager := &MockKeyManager{}
+	handler := &ThetaRPCHandler{mockRPC, mockKeyManager, logger, nil, NewSQLSigner(mockKeyManager), nil}
+	mockKeyManager.
+		On("FindByUserId", "alice").
+		Return(getRecord(), nil)
+	mockKeyManager.
+		On("Unlock", "alice", "").
+		Return(Record{}, ErrWrongPassphrase)
+
+	address, _ := hex.DecodeString("EFEE576F3D668674BC73E007F6ABFA243311BD37")
+	args := &SendArgs{
+		To: []types.TxOutput{{
+			Address: address,
+			Coins:   types.Coins{{Amount: 123, Denom: "ThetaWei"}},
+		}},
+		Sequence: 1,
+		Fee:      types.Coin{Amount: 4, Denom: "GammaWei"},
+		Gas:      5,
+	}
+	result := &theta.BroadcastRawTransactionResult{}
+	req, _ := http.NewRequest("", "", bytes.NewBufferString(""))
+	req.Header.Add("X-Auth-User", "alice")
+	err := handler.Send(req, args, result)
+	assert.Equal(ErrWrongPassphrase, err)
+}
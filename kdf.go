@@ -0,0 +1,91 @@
+package vault
+
+import (
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/spf13/viper"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// KDF derives a symmetric encryption key from a user-supplied passphrase and
+// a per-record salt. Params is persisted alongside the ciphertext so a
+// record can always be re-derived, even if the configured defaults change.
+type KDF interface {
+	Name() string
+	Params() map[string]interface{}
+	DeriveKey(passphrase string, salt []byte) ([]byte, error)
+}
+
+const keyLen = 32 // AES-256
+
+type ScryptKDF struct {
+	N, R, P int
+}
+
+func NewScryptKDFFromConfig() ScryptKDF {
+	n := viper.GetInt("ScryptN")
+	if n == 0 {
+		n = 1 << 18
+	}
+	r := viper.GetInt("ScryptR")
+	if r == 0 {
+		r = 8
+	}
+	p := viper.GetInt("ScryptP")
+	if p == 0 {
+		p = 1
+	}
+	return ScryptKDF{N: n, R: r, P: p}
+}
+
+func (s ScryptKDF) Name() string {
+	return "scrypt"
+}
+
+func (s ScryptKDF) Params() map[string]interface{} {
+	return map[string]interface{}{"n": s.N, "r": s.R, "p": s.P, "dklen": keyLen}
+}
+
+func (s ScryptKDF) DeriveKey(passphrase string, salt []byte) ([]byte, error) {
+	return scrypt.Key([]byte(passphrase), salt, s.N, s.R, s.P, keyLen)
+}
+
+type PBKDF2KDF struct {
+	Iterations int
+}
+
+func NewPBKDF2KDFFromConfig() PBKDF2KDF {
+	iterations := viper.GetInt("PBKDF2Iterations")
+	if iterations == 0 {
+		iterations = 262144
+	}
+	return PBKDF2KDF{Iterations: iterations}
+}
+
+func (p PBKDF2KDF) Name() string {
+	return "pbkdf2"
+}
+
+func (p PBKDF2KDF) Params() map[string]interface{} {
+	return map[string]interface{}{"c": p.Iterations, "prf": "hmac-sha256", "dklen": keyLen}
+}
+
+func (p PBKDF2KDF) DeriveKey(passphrase string, salt []byte) ([]byte, error) {
+	return pbkdf2.Key([]byte(passphrase), salt, p.Iterations, keyLen, sha256.New), nil
+}
+
+// NewKDFFromConfig picks the KDF implementation named by the "KDF" viper key
+// (defaulting to scrypt), with parameters read from the corresponding
+// Scrypt*/PBKDF2* keys.
+func NewKDFFromConfig() (KDF, error) {
+	switch viper.GetString("KDF") {
+	case "", "scrypt":
+		return NewScryptKDFFromConfig(), nil
+	case "pbkdf2":
+		return NewPBKDF2KDFFromConfig(), nil
+	default:
+		return nil, fmt.Errorf("unknown KDF: %s", viper.GetString("KDF"))
+	}
+}
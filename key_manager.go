@@ -5,8 +5,10 @@ import (
 	"encoding/hex"
 	"fmt"
 	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
 	crypto "github.com/thetatoken/theta/go-crypto"
 	"github.com/thetatoken/theta/go-crypto/keys"
 	"github.com/thetatoken/theta/types"
@@ -18,13 +20,39 @@ type Record struct {
 	PubKey     crypto.PubKey
 	PrivateKey crypto.PrivKey
 	Type       string
+	// Path is the SLIP-0010 derivation path this record was derived at,
+	// empty for the master record itself.
+	Path string
 }
 
 type KeyManager interface {
 	Close()
-	FindByUserId(userid string) (Record, error)
-	// FindByAddress(address string) (Record, error)
+	// FindByUserId returns userid's address/pubkey. An optional derivation
+	// path (e.g. "m/44'/500'/0'/0/1") looks up a previously-derived
+	// subaccount instead of the master record.
+	FindByUserId(userid string, path ...string) (Record, error)
+	// FindByAddress is the inverse of FindByUserId: given a chain address,
+	// it returns the userid that owns it. Used to map events keyed by
+	// address (e.g. upstream tx notifications) back to the vault user they
+	// belong to.
+	FindByAddress(address string) (Record, error)
 	Create(r Record) error
+	// Unlock decrypts the stored private key for userid using passphrase,
+	// provisioning a brand-new encrypted record if one doesn't exist yet.
+	// Successful unlocks are cached in memory for a short TTL.
+	Unlock(userid, passphrase string) (Record, error)
+	// ChangePassphrase re-encrypts userid's private key under newPassphrase,
+	// invalidating any cached copy of the old encryption.
+	ChangePassphrase(userid, oldPassphrase, newPassphrase string) error
+	// ExportMnemonic returns the master seed phrase for userid, decrypted
+	// with passphrase, so a hosted user can recover their wallet elsewhere.
+	ExportMnemonic(userid, passphrase string) (string, error)
+	// ImportMnemonic restores userid's master key from a previously
+	// exported seed phrase, re-encrypting it under passphrase.
+	ImportMnemonic(userid string, words []string, passphrase string) error
+	// DeriveSubaccount derives and persists a child Ed25519 key at path
+	// (SLIP-0010, e.g. "m/44'/500'/0'/0/1") from userid's master key.
+	DeriveSubaccount(userid, passphrase, path string) (Record, error)
 }
 
 func Sign(pubKey crypto.PubKey, privKey crypto.PrivKey, tx keys.Signable) ([]byte, error) {
@@ -48,28 +76,178 @@ func genKey() (address string, pubkey crypto.PubKey, privKey crypto.PrivKey, see
 
 // ----------------- SQL KeyManager ---------------------
 
-var _ KeyManager = SqlKeyManager{}
+var _ KeyManager = &SqlKeyManager{}
 
 const TableName = "user_theta_native_wallet"
 
+// SubaccountsTableName holds one row per (userid, path) HD-derived child
+// key, keyed the same way the schema description in the backlog spells it
+// out: userid + SLIP-0010 path.
+const SubaccountsTableName = "subaccounts"
+
+// defaultCacheTTL bounds how long a decrypted private key is kept in
+// memory after a successful Unlock, so a leaked process dump can't yield
+// indefinitely-valid key material.
+const defaultCacheTTL = 10 * time.Minute
+
 type SqlKeyManager struct {
-	db *sql.DB
+	db     *sql.DB
+	cipher Cipher
+	kdf    KDF
+	cache  *decryptedKeyCache
 }
 
 func NewSqlKeyManager(db *sql.DB) (*SqlKeyManager, error) {
-	return &SqlKeyManager{db}, nil
+	kdf, err := NewKDFFromConfig()
+	if err != nil {
+		return nil, err
+	}
+	ttl := time.Duration(viper.GetInt("KeyCacheTTLSeconds")) * time.Second
+	if ttl == 0 {
+		ttl = defaultCacheTTL
+	}
+	return &SqlKeyManager{
+		db:     db,
+		cipher: NewAESGCMCipher(),
+		kdf:    kdf,
+		cache:  newDecryptedKeyCache(ttl),
+	}, nil
 }
 
-func (km SqlKeyManager) FindByUserId(userid string) (Record, error) {
-	query := fmt.Sprintf("SELECT privkey::bytea, pubkey::bytea, address::bytea FROM %s WHERE userid=$1", TableName)
+// FindByUserId returns the address and public key for userid, or
+// ErrRecordNotFound if no row exists yet; it does not provision one (Unlock
+// does, on first use). It never touches encrypted key material; callers that need to sign must
+// go through Unlock with the user's passphrase. Passing a derivation path
+// looks up a subaccount previously created via DeriveSubaccount instead.
+func (km *SqlKeyManager) FindByUserId(userid string, path ...string) (Record, error) {
+	if len(path) > 0 && path[0] != "" {
+		return km.findSubaccount(userid, path[0])
+	}
+
+	query := fmt.Sprintf("SELECT pubkey::bytea, address::bytea FROM %s WHERE userid=$1", TableName)
 	row := km.db.QueryRow(query, userid)
 
-	var privkeyBytes, pubkeyBytes, address []byte
-	err := row.Scan(&privkeyBytes, &pubkeyBytes, &address)
+	var pubkeyBytes, address []byte
+	err := row.Scan(&pubkeyBytes, &address)
 	switch {
 	case err == sql.ErrNoRows:
-		log.Printf("No record with user ID: %s. Creating keys.", userid)
+		return Record{}, ErrRecordNotFound
+	case err != nil:
+		log.Printf(err.Error())
+		return Record{}, err
+	default:
+		pubKey := crypto.PubKey{}
+		types.FromBytes(pubkeyBytes, &pubKey)
+
+		return Record{
+			UserID:  userid,
+			PubKey:  pubKey,
+			Address: hex.EncodeToString(address),
+		}, nil
+	}
+}
+
+// FindByAddress looks up the userid owning address, checking subaccounts as
+// well as master records so a derived subaccount's events resolve back to
+// the same user as the master key's.
+func (km *SqlKeyManager) FindByAddress(address string) (Record, error) {
+	addressBytes, err := hex.DecodeString(address)
+	if err != nil {
+		return Record{}, fmt.Errorf("invalid address %q: %v", address, err)
+	}
+
+	query := fmt.Sprintf("SELECT userid, pubkey::bytea FROM %s WHERE address=$1", TableName)
+	row := km.db.QueryRow(query, addressBytes)
+	var userid string
+	var pubkeyBytes []byte
+	switch err := row.Scan(&userid, &pubkeyBytes); err {
+	case nil:
+		pubKey := crypto.PubKey{}
+		types.FromBytes(pubkeyBytes, &pubKey)
+		return Record{UserID: userid, PubKey: pubKey, Address: address}, nil
+	case sql.ErrNoRows:
+		// fall through to subaccounts
+	default:
+		return Record{}, err
+	}
+
+	query = fmt.Sprintf("SELECT userid, pubkey::bytea, path FROM %s WHERE address=$1", SubaccountsTableName)
+	row = km.db.QueryRow(query, addressBytes)
+	var path string
+	if err := row.Scan(&userid, &pubkeyBytes, &path); err != nil {
+		if err == sql.ErrNoRows {
+			return Record{}, ErrRecordNotFound
+		}
+		return Record{}, err
+	}
+	pubKey := crypto.PubKey{}
+	types.FromBytes(pubkeyBytes, &pubKey)
+	return Record{UserID: userid, PubKey: pubKey, Address: address, Path: path}, nil
+}
+
+func (km *SqlKeyManager) findSubaccount(userid, path string) (Record, error) {
+	query := fmt.Sprintf("SELECT pubkey::bytea, address::bytea FROM %s WHERE userid=$1 AND path=$2", SubaccountsTableName)
+	row := km.db.QueryRow(query, userid, path)
+
+	var pubkeyBytes, address []byte
+	if err := row.Scan(&pubkeyBytes, &address); err != nil {
+		if err == sql.ErrNoRows {
+			return Record{}, ErrRecordNotFound
+		}
+		return Record{}, err
+	}
+
+	pubKey := crypto.PubKey{}
+	types.FromBytes(pubkeyBytes, &pubKey)
+	return Record{
+		UserID:  userid,
+		PubKey:  pubKey,
+		Address: hex.EncodeToString(address),
+		Path:    path,
+	}, nil
+}
+
+func (km *SqlKeyManager) Close() {}
+
+// Create always returns an error and persists nothing: Record carries no
+// passphrase to encrypt the private key under. It exists only to satisfy
+// KeyManager; new records are provisioned by Unlock, which creates on first use.
+func (km *SqlKeyManager) Create(record Record) error {
+	return fmt.Errorf("Create requires a passphrase; use Unlock to provision a new record")
+}
+
+func (km *SqlKeyManager) createWithPassphrase(record Record, passphrase string) error {
+	envelope, err := sealPrivKey(km.kdf, km.cipher, record.PrivateKey, passphrase)
+	if err != nil {
+		return err
+	}
 
+	pubkeyBytes, err := types.ToBytes(&record.PubKey)
+	if err != nil {
+		return err
+	}
+
+	sm := fmt.Sprintf("INSERT INTO %s (userid, pubkey, privkey, address) VALUES ($1, DECODE($2, 'hex'), $3, DECODE($4, 'hex'))", TableName)
+	_, err = km.db.Exec(sm, record.UserID, hex.EncodeToString(pubkeyBytes), envelope, record.Address)
+	return err
+}
+
+// Unlock decrypts userid's private key with passphrase. A legacy plaintext
+// row (pre-dating encryption-at-rest) is transparently re-encrypted under
+// passphrase on first unlock. Successful unlocks are cached for a short TTL
+// so repeated signing calls don't re-run the KDF every time.
+func (km *SqlKeyManager) Unlock(userid, passphrase string) (Record, error) {
+	if record, ok := km.cache.get(userid, passphrase); ok {
+		return record, nil
+	}
+
+	query := fmt.Sprintf("SELECT privkey, pubkey::bytea, address::bytea FROM %s WHERE userid=$1", TableName)
+	row := km.db.QueryRow(query, userid)
+
+	var privkeyRaw, pubkeyBytes, address []byte
+	err := row.Scan(&privkeyRaw, &pubkeyBytes, &address)
+	switch {
+	case err == sql.ErrNoRows:
 		address, pubkey, privkey, _, err := genKey()
 		if err != nil {
 			return Record{}, err
@@ -80,45 +258,146 @@ func (km SqlKeyManager) FindByUserId(userid string) (Record, error) {
 			PrivateKey: privkey,
 			UserID:     userid,
 		}
-		err = km.Create(record)
-		if err != nil {
+		if err := km.createWithPassphrase(record, passphrase); err != nil {
 			log.WithError(err).WithField("userid", userid).Error("Failed to create address")
 			return Record{}, err
 		}
+		km.cache.put(userid, passphrase, record)
 		return record, nil
 	case err != nil:
-		log.Printf(err.Error())
 		return Record{}, err
-	default:
-		pubKey := crypto.PubKey{}
-		types.FromBytes(pubkeyBytes, &pubKey)
-		privKey := crypto.PrivKey{}
-		types.FromBytes(privkeyBytes, &privKey)
+	}
 
-		record := Record{
-			UserID:     userid,
-			PubKey:     pubKey,
-			PrivateKey: privKey,
-			Address:    hex.EncodeToString(address),
+	pubKey := crypto.PubKey{}
+	types.FromBytes(pubkeyBytes, &pubKey)
+
+	privKey, err := openPrivKey(km.cipher, privkeyRaw, passphrase)
+	if err != nil {
+		legacyKey := crypto.PrivKey{}
+		types.FromBytes(privkeyRaw, &legacyKey)
+		if hex.EncodeToString(legacyKey.PubKey().Address()) != hex.EncodeToString(address) {
+			return Record{}, err
 		}
-		return record, nil
+		privKey = legacyKey
+		if reErr := km.reencrypt(userid, privKey, passphrase); reErr != nil {
+			log.WithError(reErr).WithField("userid", userid).Error("Failed to migrate plaintext key to encrypted storage")
+		}
+	}
+
+	record := Record{
+		UserID:     userid,
+		PubKey:     pubKey,
+		PrivateKey: privKey,
+		Address:    hex.EncodeToString(address),
 	}
+	km.cache.put(userid, passphrase, record)
+	return record, nil
 }
 
-func (km SqlKeyManager) Close() {}
+// reencrypt rewrites a legacy plaintext row as an encrypted envelope,
+// completing the migration path for rows created before encryption-at-rest.
+func (km *SqlKeyManager) reencrypt(userid string, privKey crypto.PrivKey, passphrase string) error {
+	envelope, err := sealPrivKey(km.kdf, km.cipher, privKey, passphrase)
+	if err != nil {
+		return err
+	}
+	sm := fmt.Sprintf("UPDATE %s SET privkey=$1 WHERE userid=$2", TableName)
+	_, err = km.db.Exec(sm, envelope, userid)
+	return err
+}
 
-func (km SqlKeyManager) Create(record Record) error {
-	sm := fmt.Sprintf("INSERT INTO %s (userid, pubkey, privkey, address) VALUES ($1, DECODE($2, 'hex'), DECODE($3, 'hex'), DECODE($4, 'hex'))", TableName)
+func (km *SqlKeyManager) ChangePassphrase(userid, oldPassphrase, newPassphrase string) error {
+	km.cache.invalidate(userid)
+	record, err := km.Unlock(userid, oldPassphrase)
+	if err != nil {
+		return err
+	}
+	if err := km.reencrypt(userid, record.PrivateKey, newPassphrase); err != nil {
+		return err
+	}
+	km.cache.put(userid, newPassphrase, record)
+	return nil
+}
 
-	pubkeyBytes, err := types.ToBytes(&record.PubKey)
+// ExportMnemonic decrypts userid's master key and returns it as a seed
+// phrase, using the same word codec genKey already generates (and
+// previously threw away) when provisioning a new record.
+func (km *SqlKeyManager) ExportMnemonic(userid, passphrase string) (string, error) {
+	record, err := km.Unlock(userid, passphrase)
+	if err != nil {
+		return "", err
+	}
+	return privKeyToMnemonic(record.PrivateKey)
+}
+
+// ImportMnemonic restores userid's master key from words, overwriting
+// whatever key (if any) is currently stored, re-encrypted under passphrase.
+func (km *SqlKeyManager) ImportMnemonic(userid string, words []string, passphrase string) error {
+	privKey, err := mnemonicToPrivKey(words)
+	if err != nil {
+		return err
+	}
+	pubKey := privKey.PubKey()
+	record := Record{
+		UserID:     userid,
+		Address:    hex.EncodeToString(pubKey.Address()),
+		PubKey:     pubKey,
+		PrivateKey: privKey,
+	}
+
+	envelope, err := sealPrivKey(km.kdf, km.cipher, privKey, passphrase)
 	if err != nil {
 		return err
 	}
-	privBytes, err := types.ToBytes(&record.PrivateKey)
+	pubkeyBytes, err := types.ToBytes(&pubKey)
 	if err != nil {
 		return err
 	}
+	sm := fmt.Sprintf(`INSERT INTO %s (userid, pubkey, privkey, address) VALUES ($1, DECODE($2, 'hex'), $3, DECODE($4, 'hex'))
+		ON CONFLICT (userid) DO UPDATE SET pubkey=EXCLUDED.pubkey, privkey=EXCLUDED.privkey, address=EXCLUDED.address`, TableName)
+	if _, err := km.db.Exec(sm, userid, hex.EncodeToString(pubkeyBytes), envelope, record.Address); err != nil {
+		return err
+	}
 
-	_, err = km.db.Exec(sm, record.UserID, hex.EncodeToString(pubkeyBytes), hex.EncodeToString(privBytes), record.Address)
-	return err
+	km.cache.put(userid, passphrase, record)
+	return nil
+}
+
+// DeriveSubaccount derives a child Ed25519 key at path from userid's
+// master key (treated as a BIP32/SLIP-0010 root) and persists it so later
+// lookups can address it via FindByUserId(userid, path).
+func (km *SqlKeyManager) DeriveSubaccount(userid, passphrase, path string) (Record, error) {
+	master, err := km.Unlock(userid, passphrase)
+	if err != nil {
+		return Record{}, err
+	}
+
+	privKey, err := deriveSLIP10(master.PrivateKey, path)
+	if err != nil {
+		return Record{}, err
+	}
+	pubKey := privKey.PubKey()
+	record := Record{
+		UserID:     userid,
+		Address:    hex.EncodeToString(pubKey.Address()),
+		PubKey:     pubKey,
+		PrivateKey: privKey,
+		Path:       path,
+	}
+
+	envelope, err := sealPrivKey(km.kdf, km.cipher, privKey, passphrase)
+	if err != nil {
+		return Record{}, err
+	}
+	pubkeyBytes, err := types.ToBytes(&pubKey)
+	if err != nil {
+		return Record{}, err
+	}
+	sm := fmt.Sprintf(`INSERT INTO %s (userid, path, pubkey, privkey, address) VALUES ($1, $2, DECODE($3, 'hex'), $4, DECODE($5, 'hex'))
+		ON CONFLICT (userid, path) DO UPDATE SET pubkey=EXCLUDED.pubkey, privkey=EXCLUDED.privkey, address=EXCLUDED.address`, SubaccountsTableName)
+	if _, err := km.db.Exec(sm, userid, path, hex.EncodeToString(pubkeyBytes), envelope, record.Address); err != nil {
+		return Record{}, err
+	}
+
+	return record, nil
 }
@@ -0,0 +1,180 @@
+package vault
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	crypto "github.com/thetatoken/theta/go-crypto"
+	"github.com/thetatoken/theta/types"
+)
+
+const saltLen = 32
+
+// keyEnvelope is the JSON document stored in the privkey column. It follows
+// the same {kdf, kdfparams, cipher, ciphertext, iv, mac} shape used by the
+// go-ethereum/tendermint keystores so existing tooling can reason about it.
+type keyEnvelope struct {
+	KDF        string                 `json:"kdf"`
+	KDFParams  map[string]interface{} `json:"kdfparams"`
+	Salt       string                 `json:"salt"`
+	Cipher     string                 `json:"cipher"`
+	CipherText string                 `json:"ciphertext"`
+	IV         string                 `json:"iv"`
+	MAC        string                 `json:"mac"`
+}
+
+func sealPrivKey(kdf KDF, ciph Cipher, privKey crypto.PrivKey, passphrase string) ([]byte, error) {
+	salt := make([]byte, saltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	derivedKey, err := kdf.DeriveKey(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	ciphertext, iv, mac, err := ciph.Encrypt(derivedKey, privKey.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	env := keyEnvelope{
+		KDF:        kdf.Name(),
+		KDFParams:  kdf.Params(),
+		Salt:       hex.EncodeToString(salt),
+		Cipher:     ciph.Name(),
+		CipherText: hex.EncodeToString(ciphertext),
+		IV:         hex.EncodeToString(iv),
+		MAC:        hex.EncodeToString(mac),
+	}
+	return json.Marshal(env)
+}
+
+func openPrivKey(ciph Cipher, raw []byte, passphrase string) (crypto.PrivKey, error) {
+	var env keyEnvelope
+	if err := json.Unmarshal(raw, &env); err != nil {
+		return crypto.PrivKey{}, fmt.Errorf("not an encrypted key envelope: %v", err)
+	}
+	if env.Cipher != ciph.Name() {
+		return crypto.PrivKey{}, fmt.Errorf("unsupported cipher in envelope: %s", env.Cipher)
+	}
+	kdf, err := kdfFromEnvelope(env)
+	if err != nil {
+		return crypto.PrivKey{}, err
+	}
+	salt, err := hex.DecodeString(env.Salt)
+	if err != nil {
+		return crypto.PrivKey{}, err
+	}
+	ciphertext, err := hex.DecodeString(env.CipherText)
+	if err != nil {
+		return crypto.PrivKey{}, err
+	}
+	iv, err := hex.DecodeString(env.IV)
+	if err != nil {
+		return crypto.PrivKey{}, err
+	}
+	mac, err := hex.DecodeString(env.MAC)
+	if err != nil {
+		return crypto.PrivKey{}, err
+	}
+	derivedKey, err := kdf.DeriveKey(passphrase, salt)
+	if err != nil {
+		return crypto.PrivKey{}, err
+	}
+	plaintext, err := ciph.Decrypt(derivedKey, ciphertext, iv, mac)
+	if err != nil {
+		return crypto.PrivKey{}, ErrWrongPassphrase
+	}
+	privKey := crypto.PrivKey{}
+	types.FromBytes(plaintext, &privKey)
+	return privKey, nil
+}
+
+// kdfFromEnvelope reconstructs the exact KDF + params a record was sealed
+// with, so rotating the configured defaults never breaks existing records.
+func kdfFromEnvelope(env keyEnvelope) (KDF, error) {
+	switch env.KDF {
+	case "scrypt":
+		return ScryptKDF{
+			N: intParam(env.KDFParams, "n"),
+			R: intParam(env.KDFParams, "r"),
+			P: intParam(env.KDFParams, "p"),
+		}, nil
+	case "pbkdf2":
+		return PBKDF2KDF{Iterations: intParam(env.KDFParams, "c")}, nil
+	default:
+		return nil, fmt.Errorf("unknown KDF in envelope: %s", env.KDF)
+	}
+}
+
+func intParam(params map[string]interface{}, key string) int {
+	switch v := params[key].(type) {
+	case int:
+		return v
+	case float64:
+		return int(v)
+	default:
+		return 0
+	}
+}
+
+var ErrWrongPassphrase = fmt.Errorf("wrong passphrase")
+var ErrRecordNotFound = fmt.Errorf("no record found for user")
+
+// decryptedKeyCache holds recently-unlocked private keys in memory for a
+// short TTL so a user isn't forced to resend their passphrase on every
+// signing call within the same session.
+type decryptedKeyCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]cachedEntry
+}
+
+type cachedEntry struct {
+	record         Record
+	passphraseHash [32]byte
+	expiresAt      time.Time
+}
+
+func newDecryptedKeyCache(ttl time.Duration) *decryptedKeyCache {
+	return &decryptedKeyCache{ttl: ttl, entries: map[string]cachedEntry{}}
+}
+
+// get returns the cached record for userid only if passphrase matches the
+// one the entry was cached under. A userid hit with the wrong passphrase is
+// treated as a cache miss, not a different user's key handed out for free.
+func (c *decryptedKeyCache) get(userid, passphrase string) (Record, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[userid]
+	if !ok || time.Now().After(entry.expiresAt) {
+		delete(c.entries, userid)
+		return Record{}, false
+	}
+	hash := sha256.Sum256([]byte(passphrase))
+	if subtle.ConstantTimeCompare(entry.passphraseHash[:], hash[:]) != 1 {
+		return Record{}, false
+	}
+	return entry.record, true
+}
+
+func (c *decryptedKeyCache) put(userid, passphrase string, record Record) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[userid] = cachedEntry{
+		record:         record,
+		passphraseHash: sha256.Sum256([]byte(passphrase)),
+		expiresAt:      time.Now().Add(c.ttl),
+	}
+}
+
+func (c *decryptedKeyCache) invalidate(userid string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, userid)
+}
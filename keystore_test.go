@@ -0,0 +1,113 @@
+package vault
+
+import (
+	"testing"
+	"time"
+
+	crypto "github.com/thetatoken/theta/go-crypto"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAESGCMCipherRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+
+	ciph := NewAESGCMCipher()
+	key := make([]byte, 32)
+	plaintext := []byte("super secret private key bytes")
+
+	ciphertext, iv, mac, err := ciph.Encrypt(key, plaintext)
+	assert.NoError(err)
+
+	decrypted, err := ciph.Decrypt(key, ciphertext, iv, mac)
+	assert.NoError(err)
+	assert.Equal(plaintext, decrypted)
+
+	wrongKey := make([]byte, 32)
+	wrongKey[0] = 1
+	_, err = ciph.Decrypt(wrongKey, ciphertext, iv, mac)
+	assert.Error(err)
+}
+
+func TestScryptKDFDeriveKey(t *testing.T) {
+	assert := assert.New(t)
+
+	kdf := ScryptKDF{N: 1 << 14, R: 8, P: 1}
+	salt := []byte("0123456789abcdef0123456789abcdef")
+
+	key1, err := kdf.DeriveKey("passphrase", salt)
+	assert.NoError(err)
+	key2, err := kdf.DeriveKey("passphrase", salt)
+	assert.NoError(err)
+	assert.Equal(key1, key2)
+
+	key3, err := kdf.DeriveKey("different", salt)
+	assert.NoError(err)
+	assert.NotEqual(key1, key3)
+}
+
+func TestPBKDF2KDFDeriveKey(t *testing.T) {
+	assert := assert.New(t)
+
+	kdf := PBKDF2KDF{Iterations: 1024}
+	salt := []byte("0123456789abcdef0123456789abcdef")
+
+	key1, err := kdf.DeriveKey("passphrase", salt)
+	assert.NoError(err)
+	key2, err := kdf.DeriveKey("passphrase", salt)
+	assert.NoError(err)
+	assert.Equal(key1, key2)
+
+	key3, err := kdf.DeriveKey("different", salt)
+	assert.NoError(err)
+	assert.NotEqual(key1, key3)
+}
+
+func TestSealOpenPrivKeyRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+
+	privKey := crypto.GenPrivKeyEd25519().Wrap()
+	kdf := ScryptKDF{N: 1 << 14, R: 8, P: 1}
+	ciph := NewAESGCMCipher()
+
+	envelope, err := sealPrivKey(kdf, ciph, privKey, "hunter2")
+	assert.NoError(err)
+
+	opened, err := openPrivKey(ciph, envelope, "hunter2")
+	assert.NoError(err)
+	assert.Equal(privKey.Bytes(), opened.Bytes())
+
+	_, err = openPrivKey(ciph, envelope, "wrong passphrase")
+	assert.Equal(ErrWrongPassphrase, err)
+}
+
+// TestDecryptedKeyCacheRequiresMatchingPassphrase guards against the cache
+// handing back a decrypted key to anyone who merely knows a userid that was
+// unlocked earlier, regardless of what passphrase (if any) they supply now.
+func TestDecryptedKeyCacheRequiresMatchingPassphrase(t *testing.T) {
+	assert := assert.New(t)
+
+	cache := newDecryptedKeyCache(time.Minute)
+	record := Record{UserID: "alice", Address: "deadbeef"}
+	cache.put("alice", "correct-passphrase", record)
+
+	got, ok := cache.get("alice", "correct-passphrase")
+	assert.True(ok)
+	assert.Equal(record, got)
+
+	_, ok = cache.get("alice", "wrong-passphrase")
+	assert.False(ok)
+
+	_, ok = cache.get("alice", "")
+	assert.False(ok)
+}
+
+func TestDecryptedKeyCacheExpiry(t *testing.T) {
+	assert := assert.New(t)
+
+	cache := newDecryptedKeyCache(-time.Second)
+	cache.put("alice", "pw", Record{UserID: "alice"})
+
+	_, ok := cache.get("alice", "pw")
+	assert.False(ok)
+}
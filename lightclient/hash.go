@@ -0,0 +1,21 @@
+package lightclient
+
+import "crypto/sha256"
+
+// leafHash and innerHash mirror IAVL's node hashing so a re-hashed proof
+// can be compared directly against the tree's root (the block's AppHash).
+func leafHash(key, value []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{0x00}) // leaf prefix
+	h.Write(key)
+	h.Write(value)
+	return h.Sum(nil)
+}
+
+func innerHash(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{0x01}) // inner-node prefix
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
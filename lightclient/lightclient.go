@@ -0,0 +1,240 @@
+// Package lightclient implements the basecli/proxy pattern for the vault:
+// rather than trusting the upstream theta node's JSON-RPC responses
+// outright, it independently verifies them against a locally-tracked
+// validator set, the same way a light client verifies blocks it didn't
+// execute itself.
+package lightclient
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	tmtypes "github.com/tendermint/tendermint/types"
+	"github.com/thetatoken/theta/types"
+	rpcc "github.com/ybbus/jsonrpc"
+)
+
+// ErrProofVerification is returned whenever a response from the upstream
+// node fails local verification, so callers (and the handler's JSON-RPC
+// error code for it) can tell it apart from an ordinary RPC failure.
+type ErrProofVerification struct {
+	Reason string
+}
+
+func (e ErrProofVerification) Error() string {
+	return fmt.Sprintf("light client proof verification failed: %s", e.Reason)
+}
+
+// Verifier tracks a trusted validator set and uses it to verify commit
+// signatures and IAVL proofs returned by the upstream node, instead of
+// blindly trusting rpcc's response.
+type Verifier struct {
+	rpc     rpcc.RPCClient
+	logger  *log.Entry
+	mu      sync.Mutex
+	height  int64
+	valSet  *tmtypes.ValidatorSet
+}
+
+// NewVerifier bootstraps a Verifier from the trusted validator set seed
+// configured via viper ("TrustRootHeight" / "TrustRootValidatorSetHash").
+// TrustRootValidatorSetHash must be obtained out-of-band (e.g. from a
+// validator operator, not from the node being verified) and is checked
+// against the validator set rpc hands back for TrustRootHeight, so the
+// node can't simply hand the verifier a root of its own choosing.
+func NewVerifier(rpc rpcc.RPCClient) (*Verifier, error) {
+	v := &Verifier{
+		rpc:    rpc,
+		logger: log.WithFields(log.Fields{"component": "lightclient"}),
+	}
+	rootHeight := viper.GetInt64("TrustRootHeight")
+	rootHashHex := viper.GetString("TrustRootValidatorSetHash")
+	if rootHashHex == "" {
+		return nil, fmt.Errorf("TrustRootValidatorSetHash must be configured to bootstrap a light client trust root")
+	}
+	rootHash, err := hex.DecodeString(rootHashHex)
+	if err != nil {
+		return nil, fmt.Errorf("invalid TrustRootValidatorSetHash: %v", err)
+	}
+	valSet, err := v.fetchValidatorSet(rootHeight)
+	if err != nil {
+		return nil, fmt.Errorf("failed to bootstrap trust root at height %d: %v", rootHeight, err)
+	}
+	if !bytes.Equal(valSet.Hash(), rootHash) {
+		return nil, ErrProofVerification{Reason: fmt.Sprintf("validator set at trust root height %d does not match configured TrustRootValidatorSetHash", rootHeight)}
+	}
+	v.height = rootHeight
+	v.valSet = valSet
+	return v, nil
+}
+
+// VerifyAccountProof checks that account, as reported by the upstream node
+// for address at height, is consistent with the IAVL proof for that height.
+// It advances the tracked validator set up to height if needed, and binds
+// the proof to the header it independently fetched and verified along the
+// way: the node-supplied proof.AppHash and proof.Commit are never trusted
+// directly, only header.AppHash from the header the Verifier itself
+// validated under the trusted validator-set chain.
+func (v *Verifier) VerifyAccountProof(address string, account *types.Account, height int64, proof *AccountProof) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	header, commit, err := v.advanceTo(height)
+	if err != nil {
+		return err
+	}
+	if commit.Height() != height {
+		return ErrProofVerification{Reason: fmt.Sprintf("verified commit height %d does not match requested height %d", commit.Height(), height)}
+	}
+	if !bytes.Equal(header.AppHash, proof.AppHash) {
+		return ErrProofVerification{Reason: "proof AppHash does not match the independently-verified block header"}
+	}
+	if err := verifyIAVLProof(proof, address, account); err != nil {
+		return ErrProofVerification{Reason: err.Error()}
+	}
+	return nil
+}
+
+// advanceTo follows validator-set changes from the last height we trust up
+// to height, one block at a time, and returns the verified header and
+// commit for height itself so callers can bind a proof to them instead of
+// trusting node-supplied proof material in isolation. At each step it
+// checks the signed header was actually produced by the validator set we
+// currently trust (not just whatever the node claims the new set is), then
+// only adopts the next validator set once its hash matches the header's
+// NextValidatorsHash — the same chaining a real light client uses so an
+// upstream node can't hand back a validator set and commit it controls and
+// have that accepted as a valid transition.
+func (v *Verifier) advanceTo(height int64) (*tmtypes.Header, *tmtypes.Commit, error) {
+	if height < v.height {
+		return nil, nil, fmt.Errorf("cannot verify height %d: already advanced past it to height %d", height, v.height)
+	}
+
+	var header *tmtypes.Header
+	var commit *tmtypes.Commit
+	for {
+		h, c, err := v.fetchSignedHeader(v.height)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to fetch signed header at height %d: %v", v.height, err)
+		}
+		if !bytes.Equal(h.ValidatorsHash, v.valSet.Hash()) {
+			return nil, nil, ErrProofVerification{Reason: fmt.Sprintf("validator set at height %d does not match the set trusted from the previous height", v.height)}
+		}
+		if err := verifyCommit(c, v.valSet); err != nil {
+			return nil, nil, ErrProofVerification{Reason: fmt.Sprintf("commit at height %d: %v", v.height, err)}
+		}
+		header, commit = h, c
+		if v.height == height {
+			return header, commit, nil
+		}
+
+		next, err := v.fetchValidatorSet(v.height + 1)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to fetch validator set for height %d: %v", v.height+1, err)
+		}
+		if !bytes.Equal(next.Hash(), h.NextValidatorsHash) {
+			return nil, nil, ErrProofVerification{Reason: fmt.Sprintf("validator set for height %d is not the one committed to by height %d's header", v.height+1, v.height)}
+		}
+		v.valSet = next
+		v.height++
+	}
+}
+
+func (v *Verifier) fetchValidatorSet(height int64) (*tmtypes.ValidatorSet, error) {
+	resp, err := v.rpc.Call("validators", map[string]interface{}{"height": height})
+	if err != nil {
+		return nil, err
+	}
+	if resp.Error != nil {
+		return nil, resp.Error
+	}
+	var result struct {
+		Validators []*tmtypes.Validator `json:"validators"`
+	}
+	if err := resp.GetObject(&result); err != nil {
+		return nil, err
+	}
+	return tmtypes.NewValidatorSet(result.Validators), nil
+}
+
+// fetchSignedHeader returns the header and commit the upstream node claims
+// for height. Callers must not trust either in isolation: advanceTo checks
+// the header's ValidatorsHash against the set it already trusts before
+// relying on the commit or chaining to NextValidatorsHash.
+func (v *Verifier) fetchSignedHeader(height int64) (*tmtypes.Header, *tmtypes.Commit, error) {
+	resp, err := v.rpc.Call("commit", map[string]interface{}{"height": height})
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.Error != nil {
+		return nil, nil, resp.Error
+	}
+	var result struct {
+		SignedHeader struct {
+			Header *tmtypes.Header `json:"header"`
+			Commit *tmtypes.Commit `json:"commit"`
+		} `json:"signed_header"`
+	}
+	if err := resp.GetObject(&result); err != nil {
+		return nil, nil, err
+	}
+	if result.SignedHeader.Header == nil || result.SignedHeader.Commit == nil {
+		return nil, nil, fmt.Errorf("commit response missing header or commit")
+	}
+	return result.SignedHeader.Header, result.SignedHeader.Commit, nil
+}
+
+// AccountProof is the Merkle proof material the upstream node returns
+// alongside an account: the IAVL key/value proof and the AppHash/commit it
+// claims to be against. AppHash and Commit are node-supplied and are never
+// trusted directly — VerifyAccountProof binds the IAVL proof to the
+// AppHash of the header it independently fetched and verified instead, and
+// ignores Commit in favor of the commit it fetched itself for the same
+// height. They're kept on the struct only to describe the wire shape the
+// node's response is decoded from.
+type AccountProof struct {
+	AppHash []byte
+	Commit  *tmtypes.Commit
+	Ops     []IAVLProofOp
+}
+
+// IAVLProofOp is one step of an IAVL existence proof: the sibling hash and
+// whether it belongs on the left or right of the node being hashed up.
+type IAVLProofOp struct {
+	Hash   []byte
+	IsLeft bool
+}
+
+func verifyCommit(commit *tmtypes.Commit, valSet *tmtypes.ValidatorSet) error {
+	if commit == nil {
+		return fmt.Errorf("missing commit")
+	}
+	return valSet.VerifyCommit(commit.ChainID, commit.BlockID, commit.Height(), commit)
+}
+
+// verifyIAVLProof re-hashes proof.Ops bottom-up from the leaf encoding of
+// (address, account) and checks the result equals proof.AppHash, exactly
+// as an IAVL client would when it doesn't trust the node to have computed
+// the root correctly itself.
+func verifyIAVLProof(proof *AccountProof, address string, account *types.Account) error {
+	leafBytes, err := types.ToBytes(account)
+	if err != nil {
+		return err
+	}
+	root := leafHash([]byte(address), leafBytes)
+	for _, op := range proof.Ops {
+		if op.IsLeft {
+			root = innerHash(op.Hash, root)
+		} else {
+			root = innerHash(root, op.Hash)
+		}
+	}
+	if !bytes.Equal(root, proof.AppHash) {
+		return fmt.Errorf("recomputed IAVL root does not match block AppHash")
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package lightclient
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thetatoken/theta/types"
+)
+
+func buildProof(address string, account *types.Account) *AccountProof {
+	leafBytes, _ := types.ToBytes(account)
+	root := leafHash([]byte(address), leafBytes)
+	sibling := []byte("some-sibling-node-hash-32-bytes!")
+	root = innerHash(root, sibling)
+	return &AccountProof{
+		AppHash: root,
+		Ops:     []IAVLProofOp{{Hash: sibling, IsLeft: false}},
+	}
+}
+
+func TestVerifyIAVLProofAccepts(t *testing.T) {
+	address := "2674ae64cb5206b2afc6b6fbd0e5a65c025b5016"
+	account := &types.Account{Balance: types.Coins{{Amount: 100}}}
+	proof := buildProof(address, account)
+
+	assert.NoError(t, verifyIAVLProof(proof, address, account))
+}
+
+// TestVerifyIAVLProofRejectsTamperedAccount is the light-client
+// tamper-rejection case: an upstream node that reports a different account
+// than the one the proof was actually built for must fail verification
+// rather than have the forged root accepted.
+func TestVerifyIAVLProofRejectsTamperedAccount(t *testing.T) {
+	address := "2674ae64cb5206b2afc6b6fbd0e5a65c025b5016"
+	account := &types.Account{Balance: types.Coins{{Amount: 100}}}
+	proof := buildProof(address, account)
+
+	tampered := &types.Account{Balance: types.Coins{{Amount: 200}}}
+	assert.Error(t, verifyIAVLProof(proof, address, tampered))
+}
+
+func TestVerifyIAVLProofRejectsTamperedSibling(t *testing.T) {
+	address := "2674ae64cb5206b2afc6b6fbd0e5a65c025b5016"
+	account := &types.Account{Balance: types.Coins{{Amount: 100}}}
+	proof := buildProof(address, account)
+
+	proof.Ops[0].Hash = []byte("a-completely-different-32-bytes")
+	assert.Error(t, verifyIAVLProof(proof, address, account))
+}
+
+func TestVerifyCommitRejectsMissingCommit(t *testing.T) {
+	assert.Error(t, verifyCommit(nil, nil))
+}
@@ -0,0 +1,106 @@
+package vault
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha512"
+	"fmt"
+	"strconv"
+	"strings"
+
+	crypto "github.com/thetatoken/theta/go-crypto"
+	"github.com/thetatoken/theta/go-crypto/keys"
+	"github.com/thetatoken/theta/types"
+)
+
+var mnemonicCodec = keys.MustLoadCodec("english")
+
+func privKeyToMnemonic(privKey crypto.PrivKey) (string, error) {
+	words, err := mnemonicCodec.BytesToWords(privKey.Bytes())
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(words, " "), nil
+}
+
+func mnemonicToPrivKey(words []string) (crypto.PrivKey, error) {
+	raw, err := mnemonicCodec.WordsToBytes(words)
+	if err != nil {
+		return crypto.PrivKey{}, fmt.Errorf("invalid mnemonic: %v", err)
+	}
+	privKey := crypto.PrivKey{}
+	types.FromBytes(raw, &privKey)
+	return privKey, nil
+}
+
+// slip10HMACKey is the domain-separation key SLIP-0010 specifies for
+// deriving Ed25519 master keys, distinct from BIP32's "Bitcoin seed".
+const slip10HMACKey = "ed25519 seed"
+
+// parsePath parses a derivation path like "m/44'/500'/0'/0/1" into its
+// hardened child indexes. SLIP-0010 only defines hardened derivation for
+// Ed25519, so every segment is treated as hardened regardless of whether
+// it's written with a trailing '.
+func parsePath(path string) ([]uint32, error) {
+	segments := strings.Split(path, "/")
+	if len(segments) == 0 || segments[0] != "m" {
+		return nil, fmt.Errorf("invalid derivation path %q: must start with \"m\"", path)
+	}
+	indexes := make([]uint32, 0, len(segments)-1)
+	for _, seg := range segments[1:] {
+		seg = strings.TrimSuffix(seg, "'")
+		n, err := strconv.ParseUint(seg, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid derivation path segment %q: %v", seg, err)
+		}
+		indexes = append(indexes, hardened(uint32(n)))
+	}
+	return indexes, nil
+}
+
+func hardened(index uint32) uint32 {
+	return index | 0x80000000
+}
+
+// deriveSLIP10 derives the Ed25519 private key at path from master's
+// private key bytes, treated as the BIP32 seed, following SLIP-0010.
+func deriveSLIP10(master crypto.PrivKey, path string) (crypto.PrivKey, error) {
+	indexes, err := parsePath(path)
+	if err != nil {
+		return crypto.PrivKey{}, err
+	}
+
+	key, chainCode := masterKeyFromSeed(master.Bytes())
+	for _, index := range indexes {
+		key, chainCode = deriveChild(key, chainCode, index)
+	}
+
+	// key is only the 32-byte Ed25519 seed; it must be expanded into the
+	// full seed+pubkey private key representation (the same shape
+	// crypto.GenPrivKeyEd25519() produces) before anything downstream
+	// signs with it, or the embedded public half won't match the scalar
+	// and signatures won't verify.
+	privKey := crypto.PrivKeyEd25519{}
+	copy(privKey[:], ed25519.NewKeyFromSeed(key[:]))
+	return privKey.Wrap(), nil
+}
+
+func masterKeyFromSeed(seed []byte) (key, chainCode [32]byte) {
+	mac := hmac.New(sha512.New, []byte(slip10HMACKey))
+	mac.Write(seed)
+	sum := mac.Sum(nil)
+	copy(key[:], sum[:32])
+	copy(chainCode[:], sum[32:])
+	return
+}
+
+func deriveChild(key, chainCode [32]byte, index uint32) (childKey, childChainCode [32]byte) {
+	mac := hmac.New(sha512.New, chainCode[:])
+	mac.Write([]byte{0x00})
+	mac.Write(key[:])
+	mac.Write([]byte{byte(index >> 24), byte(index >> 16), byte(index >> 8), byte(index)})
+	sum := mac.Sum(nil)
+	copy(childKey[:], sum[:32])
+	copy(childChainCode[:], sum[32:])
+	return
+}
@@ -0,0 +1,66 @@
+package vault
+
+import (
+	"github.com/stretchr/testify/mock"
+	rpcc "github.com/ybbus/jsonrpc"
+)
+
+type MockRPCClient struct {
+	mock.Mock
+}
+
+func (m *MockRPCClient) Call(method string, params ...interface{}) (*rpcc.RPCResponse, error) {
+	args := m.Called(method, params[0])
+	resp, _ := args.Get(0).(*rpcc.RPCResponse)
+	return resp, args.Error(1)
+}
+
+type MockKeyManager struct {
+	mock.Mock
+}
+
+func (m *MockKeyManager) Close() {}
+
+func (m *MockKeyManager) FindByUserId(userid string, path ...string) (Record, error) {
+	callArgs := []interface{}{userid}
+	for _, p := range path {
+		callArgs = append(callArgs, p)
+	}
+	args := m.Called(callArgs...)
+	return args.Get(0).(Record), args.Error(1)
+}
+
+func (m *MockKeyManager) FindByAddress(address string) (Record, error) {
+	args := m.Called(address)
+	return args.Get(0).(Record), args.Error(1)
+}
+
+func (m *MockKeyManager) Create(r Record) error {
+	args := m.Called(r)
+	return args.Error(0)
+}
+
+func (m *MockKeyManager) Unlock(userid, passphrase string) (Record, error) {
+	args := m.Called(userid, passphrase)
+	return args.Get(0).(Record), args.Error(1)
+}
+
+func (m *MockKeyManager) ChangePassphrase(userid, oldPassphrase, newPassphrase string) error {
+	args := m.Called(userid, oldPassphrase, newPassphrase)
+	return args.Error(0)
+}
+
+func (m *MockKeyManager) ExportMnemonic(userid, passphrase string) (string, error) {
+	args := m.Called(userid, passphrase)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockKeyManager) ImportMnemonic(userid string, words []string, passphrase string) error {
+	args := m.Called(userid, words, passphrase)
+	return args.Error(0)
+}
+
+func (m *MockKeyManager) DeriveSubaccount(userid, passphrase, path string) (Record, error) {
+	args := m.Called(userid, passphrase, path)
+	return args.Get(0).(Record), args.Error(1)
+}
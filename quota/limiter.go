@@ -0,0 +1,171 @@
+// Package quota implements per-user request throttling and a daily coin
+// spend cap for Send, so one abusive caller (or a faucet script gone
+// wrong) can't starve every other user of the vault.
+package quota
+
+import (
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Budget is a snapshot of a user's remaining throttling budget, returned by
+// the theta.Quota RPC method.
+type Budget struct {
+	RequestsPerSecond   float64 `json:"requestsPerSecond"`
+	RemainingBurst      float64 `json:"remainingBurst"`
+	DailyCoinCap        int64   `json:"dailyCoinCap"`
+	DailyCoinsRemaining int64   `json:"dailyCoinsRemaining"`
+}
+
+// bucket is a classic token bucket: Tokens refills at RatePerSec up to Burst,
+// and CoinsSpentToday/DayStart track the separate daily Send cap.
+type bucket struct {
+	Tokens          float64 `json:"tokens"`
+	LastRefill      time.Time `json:"lastRefill"`
+	CoinsSpentToday int64 `json:"coinsSpentToday"`
+	DayStart        time.Time `json:"dayStart"`
+}
+
+// Limiter enforces a requests/sec token bucket plus a daily coin cap for
+// Send, per X-Auth-User. It is safe for concurrent use. A Store can be
+// swapped in for Redis-backed persistence so limits survive a restart and
+// are shared across vault replicas; the default Store is in-memory only.
+type Limiter struct {
+	mu           sync.Mutex
+	store        Store
+	ratePerSec   float64
+	burst        float64
+	dailyCoinCap int64
+
+	subsMu  sync.Mutex
+	subs    map[string]int
+	maxSubs int
+}
+
+// Store persists bucket state. MemoryStore is the zero-config default;
+// a Redis-backed Store can be substituted for multi-replica deployments.
+type Store interface {
+	Get(userID string) (bucket, bool)
+	Put(userID string, b bucket)
+}
+
+func NewLimiterFromConfig(store Store) *Limiter {
+	rate := viper.GetFloat64("RateLimitRequestsPerSecond")
+	if rate == 0 {
+		rate = 5
+	}
+	burst := viper.GetFloat64("RateLimitBurst")
+	if burst == 0 {
+		burst = rate * 2
+	}
+	dailyCap := viper.GetInt64("DailyCoinCap")
+	if dailyCap == 0 {
+		dailyCap = 1_000_000
+	}
+	if store == nil {
+		store = NewMemoryStore()
+	}
+	maxSubs := viper.GetInt("MaxSubscriptionsPerUser")
+	if maxSubs == 0 {
+		maxSubs = 10
+	}
+	return &Limiter{store: store, ratePerSec: rate, burst: burst, dailyCoinCap: dailyCap, subs: map[string]int{}, maxSubs: maxSubs}
+}
+
+// Allow consumes one request token for userID, returning false if the
+// user's bucket is empty (i.e. they're over their requests/sec limit).
+func (l *Limiter) Allow(userID string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b := l.getOrInit(userID)
+	now := time.Now()
+	elapsed := now.Sub(b.LastRefill).Seconds()
+	b.Tokens = min(l.burst, b.Tokens+elapsed*l.ratePerSec)
+	b.LastRefill = now
+
+	allowed := b.Tokens >= 1
+	if allowed {
+		b.Tokens--
+	}
+	l.store.Put(userID, b)
+	return allowed
+}
+
+// AllowSend additionally checks and debits amount against userID's daily
+// coin cap, resetting the cap at the start of each UTC day.
+func (l *Limiter) AllowSend(userID string, amount int64) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b := l.getOrInit(userID)
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	if b.DayStart.Before(today) {
+		b.DayStart = today
+		b.CoinsSpentToday = 0
+	}
+
+	if b.CoinsSpentToday+amount > l.dailyCoinCap {
+		l.store.Put(userID, b)
+		return false
+	}
+	b.CoinsSpentToday += amount
+	l.store.Put(userID, b)
+	return true
+}
+
+// Budget reports userID's current standing without consuming anything.
+func (l *Limiter) Budget(userID string) Budget {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b := l.getOrInit(userID)
+	return Budget{
+		RequestsPerSecond:   l.ratePerSec,
+		RemainingBurst:      b.Tokens,
+		DailyCoinCap:        l.dailyCoinCap,
+		DailyCoinsRemaining: l.dailyCoinCap - b.CoinsSpentToday,
+	}
+}
+
+// AllowSubscribe reserves one of userID's websocket subscription slots,
+// returning false once they already hold MaxSubscriptionsPerUser open
+// streams. Unlike Allow/AllowSend this tracks live connection count rather
+// than a refilling budget, so it is kept in its own map with its own lock.
+func (l *Limiter) AllowSubscribe(userID string) bool {
+	l.subsMu.Lock()
+	defer l.subsMu.Unlock()
+	if l.subs[userID] >= l.maxSubs {
+		return false
+	}
+	l.subs[userID]++
+	return true
+}
+
+// ReleaseSubscribe frees a subscription slot reserved by AllowSubscribe,
+// called on an explicit Unsubscribe or when the client disconnects.
+func (l *Limiter) ReleaseSubscribe(userID string) {
+	l.subsMu.Lock()
+	defer l.subsMu.Unlock()
+	if l.subs[userID] > 0 {
+		l.subs[userID]--
+	}
+}
+
+func (l *Limiter) getOrInit(userID string) bucket {
+	b, ok := l.store.Get(userID)
+	if !ok {
+		now := time.Now()
+		b = bucket{Tokens: l.burst, LastRefill: now, DayStart: now.UTC().Truncate(24 * time.Hour)}
+	}
+	return b
+}
+
+func min(a, b float64) float64 {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,101 @@
+package quota
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestLimiter(rate, burst float64, dailyCap int64, maxSubs int) *Limiter {
+	viper.Set("RateLimitRequestsPerSecond", rate)
+	viper.Set("RateLimitBurst", burst)
+	viper.Set("DailyCoinCap", dailyCap)
+	viper.Set("MaxSubscriptionsPerUser", maxSubs)
+	defer func() {
+		viper.Set("RateLimitRequestsPerSecond", nil)
+		viper.Set("RateLimitBurst", nil)
+		viper.Set("DailyCoinCap", nil)
+		viper.Set("MaxSubscriptionsPerUser", nil)
+	}()
+	return NewLimiterFromConfig(NewMemoryStore())
+}
+
+func TestAllowConsumesBurstThenBlocks(t *testing.T) {
+	assert := assert.New(t)
+
+	l := newTestLimiter(1, 2, 1_000_000, 10)
+
+	assert.True(l.Allow("alice"))
+	assert.True(l.Allow("alice"))
+	assert.False(l.Allow("alice"), "third request within the same instant should exceed the 2-token burst")
+}
+
+func TestAllowRefillsOverTime(t *testing.T) {
+	assert := assert.New(t)
+
+	l := newTestLimiter(1, 1, 1_000_000, 10)
+
+	assert.True(l.Allow("alice"))
+	assert.False(l.Allow("alice"))
+
+	b, ok := l.store.Get("alice")
+	assert.True(ok)
+	b.LastRefill = b.LastRefill.Add(-2 * time.Second)
+	l.store.Put("alice", b)
+
+	assert.True(l.Allow("alice"), "bucket should have refilled after 2s at 1 token/sec")
+}
+
+func TestAllowSendEnforcesDailyCap(t *testing.T) {
+	assert := assert.New(t)
+
+	l := newTestLimiter(100, 100, 1000, 10)
+
+	assert.True(l.AllowSend("alice", 600))
+	assert.True(l.AllowSend("alice", 400))
+	assert.False(l.AllowSend("alice", 1), "spending beyond the daily cap must be rejected")
+}
+
+func TestAllowSendResetsAtNewDay(t *testing.T) {
+	assert := assert.New(t)
+
+	l := newTestLimiter(100, 100, 1000, 10)
+
+	assert.True(l.AllowSend("alice", 1000))
+	assert.False(l.AllowSend("alice", 1))
+
+	b, ok := l.store.Get("alice")
+	assert.True(ok)
+	b.DayStart = b.DayStart.Add(-25 * time.Hour)
+	l.store.Put("alice", b)
+
+	assert.True(l.AllowSend("alice", 1000), "cap should reset once DayStart rolls into a new UTC day")
+}
+
+func TestAllowSubscribeEnforcesMaxAndRelease(t *testing.T) {
+	assert := assert.New(t)
+
+	l := newTestLimiter(100, 100, 1_000_000, 2)
+
+	assert.True(l.AllowSubscribe("alice"))
+	assert.True(l.AllowSubscribe("alice"))
+	assert.False(l.AllowSubscribe("alice"), "third subscription should exceed MaxSubscriptionsPerUser")
+
+	l.ReleaseSubscribe("alice")
+	assert.True(l.AllowSubscribe("alice"), "releasing a slot should free it back up")
+}
+
+func TestBudgetReportsWithoutConsuming(t *testing.T) {
+	assert := assert.New(t)
+
+	l := newTestLimiter(1, 5, 1000, 10)
+
+	before := l.Budget("alice")
+	assert.Equal(float64(5), before.RemainingBurst)
+	assert.Equal(int64(1000), before.DailyCoinsRemaining)
+
+	after := l.Budget("alice")
+	assert.Equal(before.RemainingBurst, after.RemainingBurst, "Budget must be read-only")
+}
@@ -0,0 +1,33 @@
+package quota
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// Metrics holds the Prometheus counters for quota decisions, labeled by
+// user so operators can see who's getting throttled without grepping logs.
+type Metrics struct {
+	accepted *prometheus.CounterVec
+	rejected *prometheus.CounterVec
+}
+
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		accepted: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "vault_rpc_requests_accepted_total",
+			Help: "Number of RPC requests accepted by the quota middleware, by method and user.",
+		}, []string{"method", "userid"}),
+		rejected: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "vault_rpc_requests_rejected_total",
+			Help: "Number of RPC requests rejected by the quota middleware, by method and user.",
+		}, []string{"method", "userid"}),
+	}
+	prometheus.MustRegister(m.accepted, m.rejected)
+	return m
+}
+
+func (m *Metrics) ObserveAccepted(method, userID string) {
+	m.accepted.WithLabelValues(method, userID).Inc()
+}
+
+func (m *Metrics) ObserveRejected(method, userID string) {
+	m.rejected.WithLabelValues(method, userID).Inc()
+}
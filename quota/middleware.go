@@ -0,0 +1,89 @@
+package quota
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// RPCError is a JSON-RPC 2.0 error object, used instead of http.Error so a
+// quota rejection looks like any other JSON-RPC failure to client code.
+type RPCError struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+func (e RPCError) Error() string {
+	return e.Message
+}
+
+// ErrRateLimited is returned when a user has exhausted their requests/sec
+// token bucket.
+const ErrRateLimited = -32029
+
+// ErrDailyCoinCapExceeded is returned when a Send would push a user over
+// their configured daily coin cap.
+const ErrDailyCoinCapExceeded = -32030
+
+// peekMethod reads the JSON-RPC method out of the request body without
+// consuming it, so the gorilla/rpc dispatcher downstream still sees the
+// full body.
+func peekMethod(r *http.Request) string {
+	if r.Body == nil {
+		return ""
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return ""
+	}
+	r.Body = ioutil.NopCloser(bytes.NewBuffer(body))
+
+	var envelope struct {
+		Method string `json:"method"`
+	}
+	json.Unmarshal(body, &envelope)
+	return envelope.Method
+}
+
+func writeRPCError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK) // JSON-RPC reports errors in-body, not via HTTP status
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"error":   RPCError{Code: code, Message: message},
+		"id":      nil,
+	})
+}
+
+// Middleware reads X-Auth-User and enforces limiter's requests/sec bucket
+// before the request reaches the gorilla/rpc dispatcher. Rejections are
+// reported as a JSON-RPC error object, not a bare HTTP error, so clients
+// can distinguish "you're over quota" from a transport failure.
+func Middleware(limiter *Limiter, metrics *Metrics) func(http.Handler) http.Handler {
+	logger := log.WithFields(log.Fields{"method": "rpc.handler.quota"})
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID := r.Header.Get("X-Auth-User")
+			method := peekMethod(r)
+			if userID == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if !limiter.Allow(userID) {
+				logger.WithField("userid", userID).WithField("method", method).Warn("Rejected request over quota")
+				metrics.ObserveRejected(method, userID)
+				writeRPCError(w, ErrRateLimited, "rate limit exceeded, slow down")
+				return
+			}
+
+			metrics.ObserveAccepted(method, userID)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
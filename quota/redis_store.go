@@ -0,0 +1,46 @@
+package quota
+
+import (
+	"encoding/json"
+
+	"github.com/go-redis/redis"
+)
+
+// RedisStore persists bucket state in Redis under "vault:quota:<userID>",
+// so request limits survive restarts and are shared across vault replicas
+// sitting behind the same load balancer.
+type RedisStore struct {
+	client *redis.Client
+}
+
+func NewRedisStore(addr, password string, db int) *RedisStore {
+	return &RedisStore{client: redis.NewClient(&redis.Options{
+		Addr:     addr,
+		Password: password,
+		DB:       db,
+	})}
+}
+
+func redisKey(userID string) string {
+	return "vault:quota:" + userID
+}
+
+func (s *RedisStore) Get(userID string) (bucket, bool) {
+	raw, err := s.client.Get(redisKey(userID)).Bytes()
+	if err != nil {
+		return bucket{}, false
+	}
+	var b bucket
+	if err := json.Unmarshal(raw, &b); err != nil {
+		return bucket{}, false
+	}
+	return b, true
+}
+
+func (s *RedisStore) Put(userID string, b bucket) {
+	raw, err := json.Marshal(b)
+	if err != nil {
+		return
+	}
+	s.client.Set(redisKey(userID), raw, 0)
+}
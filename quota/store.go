@@ -0,0 +1,28 @@
+package quota
+
+import "sync"
+
+// MemoryStore is the default Store: per-process, lost on restart. Fine for
+// a single vault instance; deployments running several replicas behind a
+// load balancer should use RedisStore instead so limits are shared.
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]bucket
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: map[string]bucket{}}
+}
+
+func (s *MemoryStore) Get(userID string) (bucket, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.buckets[userID]
+	return b, ok
+}
+
+func (s *MemoryStore) Put(userID string, b bucket) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.buckets[userID] = b
+}
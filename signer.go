@@ -0,0 +1,98 @@
+package vault
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/spf13/viper"
+	crypto "github.com/thetatoken/theta/go-crypto"
+)
+
+// Signer hides private key material behind a storage-specific backend: it
+// takes the bytes a transaction wants signed and hands back a signature and
+// the corresponding public key, never the private key itself. This mirrors
+// tendermint's remote PrivValidator, which is signed against over a socket
+// so the validating key never has to leave its own process.
+type Signer interface {
+	Sign(userID, passphrase string, signBytes []byte) (crypto.Signature, crypto.PubKey, error)
+	// HealthCheck signs a throwaway nonce and verifies it came back
+	// correctly, proving the backend is reachable and functioning.
+	HealthCheck() error
+}
+
+// NewSignerFromConfig picks the Signer implementation named by the
+// "SignerBackend" viper key (sql|kms|pkcs11), defaulting to sql.
+func NewSignerFromConfig(km KeyManager) (Signer, error) {
+	switch viper.GetString("SignerBackend") {
+	case "", "sql":
+		return NewSQLSigner(km), nil
+	case "kms":
+		return NewKMSSigner(viper.GetString("KMSKeyID"), viper.GetString("KMSRegion"))
+	case "pkcs11":
+		return NewPKCS11Signer(viper.GetString("PKCS11ModulePath"), viper.GetString("PKCS11TokenLabel"), viper.GetString("PKCS11Pin"))
+	default:
+		return nil, fmt.Errorf("unknown SignerBackend: %s", viper.GetString("SignerBackend"))
+	}
+}
+
+// ----------------- SQL-backed Signer ---------------------
+
+// SQLSigner signs with a key decrypted from SqlKeyManager's encrypted
+// storage. It is the default backend and keeps today's behavior, just
+// behind the Signer interface instead of handing the caller a raw PrivKey.
+type SQLSigner struct {
+	km KeyManager
+}
+
+func NewSQLSigner(km KeyManager) *SQLSigner {
+	return &SQLSigner{km}
+}
+
+func (s *SQLSigner) Sign(userID, passphrase string, signBytes []byte) (crypto.Signature, crypto.PubKey, error) {
+	record, err := s.km.Unlock(userID, passphrase)
+	if err != nil {
+		return crypto.Signature{}, crypto.PubKey{}, err
+	}
+	return record.PrivateKey.Sign(signBytes), record.PubKey, nil
+}
+
+// healthCheckUserID is never provisioned for real, so a healthy SqlKeyManager
+// always answers it with ErrRecordNotFound; anything else (a connection
+// error, a broken query) means the database itself isn't reachable.
+const healthCheckUserID = "__vault_health_check__"
+
+// HealthCheck round-trips a throwaway key through the same seal/open path
+// Unlock uses, so a broken KDF or cipher configuration fails loudly instead
+// of surfacing as a mysterious ErrWrongPassphrase on a real user's key,
+// signs a nonce with the opened key and verifies the signature, and pings
+// the backing store via FindByUserId to catch a database that's down.
+func (s *SQLSigner) HealthCheck() error {
+	if _, err := s.km.FindByUserId(healthCheckUserID); err != nil && err != ErrRecordNotFound {
+		return fmt.Errorf("key manager health check failed: %v", err)
+	}
+
+	kdf, err := NewKDFFromConfig()
+	if err != nil {
+		return fmt.Errorf("failed to construct KDF: %v", err)
+	}
+	ciph := NewAESGCMCipher()
+	privKey := crypto.GenPrivKeyEd25519().Wrap()
+
+	const throwawayPassphrase = "vault-health-check"
+	envelope, err := sealPrivKey(kdf, ciph, privKey, throwawayPassphrase)
+	if err != nil {
+		return fmt.Errorf("failed to seal health check key: %v", err)
+	}
+	opened, err := openPrivKey(ciph, envelope, throwawayPassphrase)
+	if err != nil {
+		return fmt.Errorf("failed to open health check key: %v", err)
+	}
+	if !bytes.Equal(opened.Bytes(), privKey.Bytes()) {
+		return fmt.Errorf("health check key did not round-trip through seal/open")
+	}
+	nonce := []byte("vault-signer-healthcheck")
+	if !opened.PubKey().VerifyBytes(nonce, opened.Sign(nonce)) {
+		return fmt.Errorf("SQL health check: signature did not verify")
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package vault
+
+import (
+	"fmt"
+
+	"github.com/miekg/pkcs11"
+	crypto "github.com/thetatoken/theta/go-crypto"
+)
+
+// PKCS11Signer signs through a PKCS#11 HSM session, e.g. a CloudHSM or
+// YubiHSM module. Like KMSSigner, the private key never leaves the device;
+// the vault only ever holds a session handle and the derived public key.
+type PKCS11Signer struct {
+	ctx       *pkcs11.Ctx
+	session   pkcs11.SessionHandle
+	objHandle pkcs11.ObjectHandle
+	pubKey    crypto.PubKey
+}
+
+func NewPKCS11Signer(modulePath, tokenLabel, pin string) (*PKCS11Signer, error) {
+	if modulePath == "" {
+		return nil, fmt.Errorf("PKCS11ModulePath must be configured for SignerBackend=pkcs11")
+	}
+	ctx := pkcs11.New(modulePath)
+	if ctx == nil {
+		return nil, fmt.Errorf("failed to load PKCS#11 module at %s", modulePath)
+	}
+	if err := ctx.Initialize(); err != nil {
+		return nil, fmt.Errorf("failed to initialize PKCS#11 module: %v", err)
+	}
+
+	slot, err := findSlotByTokenLabel(ctx, tokenLabel)
+	if err != nil {
+		return nil, err
+	}
+	session, err := ctx.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION|pkcs11.CKF_RW_SESSION)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open PKCS#11 session: %v", err)
+	}
+	if err := ctx.Login(session, pkcs11.CKU_USER, pin); err != nil {
+		return nil, fmt.Errorf("failed to login to PKCS#11 token: %v", err)
+	}
+
+	objHandle, pubKey, err := findSigningKey(ctx, session)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PKCS11Signer{ctx: ctx, session: session, objHandle: objHandle, pubKey: pubKey}, nil
+}
+
+func (s *PKCS11Signer) Sign(userID, passphrase string, signBytes []byte) (crypto.Signature, crypto.PubKey, error) {
+	if err := s.ctx.SignInit(s.session, []*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_EDDSA, nil)}, s.objHandle); err != nil {
+		return crypto.Signature{}, crypto.PubKey{}, fmt.Errorf("PKCS#11 SignInit failed: %v", err)
+	}
+	raw, err := s.ctx.Sign(s.session, signBytes)
+	if err != nil {
+		return crypto.Signature{}, crypto.PubKey{}, fmt.Errorf("PKCS#11 Sign failed: %v", err)
+	}
+	sig := crypto.SignatureEd25519{}
+	copy(sig[:], raw)
+	return sig.Wrap(), s.pubKey, nil
+}
+
+func (s *PKCS11Signer) HealthCheck() error {
+	nonce := []byte("vault-signer-healthcheck")
+	sig, pubKey, err := s.Sign("", "", nonce)
+	if err != nil {
+		return err
+	}
+	if !pubKey.VerifyBytes(nonce, sig) {
+		return fmt.Errorf("PKCS#11 health check: signature did not verify")
+	}
+	return nil
+}
+
+func findSlotByTokenLabel(ctx *pkcs11.Ctx, tokenLabel string) (uint, error) {
+	slots, err := ctx.GetSlotList(true)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list PKCS#11 slots: %v", err)
+	}
+	for _, slot := range slots {
+		info, err := ctx.GetTokenInfo(slot)
+		if err == nil && info.Label == tokenLabel {
+			return slot, nil
+		}
+	}
+	return 0, fmt.Errorf("no PKCS#11 token found with label %q", tokenLabel)
+}
+
+func findSigningKey(ctx *pkcs11.Ctx, session pkcs11.SessionHandle) (pkcs11.ObjectHandle, crypto.PubKey, error) {
+	template := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_PRIVATE_KEY),
+		pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, pkcs11.CKK_EC_EDWARDS),
+	}
+	if err := ctx.FindObjectsInit(session, template); err != nil {
+		return 0, crypto.PubKey{}, err
+	}
+	defer ctx.FindObjectsFinal(session)
+
+	handles, _, err := ctx.FindObjects(session, 1)
+	if err != nil {
+		return 0, crypto.PubKey{}, err
+	}
+	if len(handles) == 0 {
+		return 0, crypto.PubKey{}, fmt.Errorf("no Ed25519 signing key found on PKCS#11 token")
+	}
+
+	pubAttrs, err := ctx.GetAttributeValue(session, handles[0], []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_EC_POINT, nil),
+	})
+	if err != nil {
+		return 0, crypto.PubKey{}, err
+	}
+	pubKey := crypto.PubKeyEd25519{}
+	copy(pubKey[:], pubAttrs[0].Value)
+	return handles[0], pubKey.Wrap(), nil
+}
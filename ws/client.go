@@ -0,0 +1,148 @@
+package ws
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/thetatoken/vault/quota"
+)
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      interface{}     `json:"id"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+}
+
+type rpcResponse struct {
+	JSONRPC string      `json:"jsonrpc"`
+	ID      interface{} `json:"id,omitempty"`
+	Result  interface{} `json:"result,omitempty"`
+	Error   *rpcError   `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type subscribeParams struct {
+	Topic string `json:"topic"`
+}
+
+type unsubscribeParams struct {
+	Subscription string `json:"subscription"`
+}
+
+// client is one authenticated websocket connection and the subscriptions it
+// currently holds, keyed by subscription ID so Unsubscribe can look them up
+// directly.
+type client struct {
+	userID string
+	conn   *conn
+	server *Server
+	subs   map[string]Topic
+}
+
+// run reads JSON-RPC requests off the connection until it closes, releasing
+// every subscription and quota slot the client held on the way out.
+func (c *client) run() {
+	defer c.close()
+	for {
+		_, raw, err := c.conn.ws.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		var req rpcRequest
+		if err := json.Unmarshal(raw, &req); err != nil {
+			c.conn.send(rpcResponse{JSONRPC: "2.0", Error: &rpcError{Code: -32700, Message: "parse error"}})
+			continue
+		}
+
+		switch req.Method {
+		case "theta.Subscribe":
+			c.handleSubscribe(req)
+		case "theta.Unsubscribe":
+			c.handleUnsubscribe(req)
+		default:
+			c.conn.send(rpcResponse{JSONRPC: "2.0", ID: req.ID, Error: &rpcError{Code: -32601, Message: "method not found"}})
+		}
+	}
+}
+
+func (c *client) handleSubscribe(req rpcRequest) {
+	var params subscribeParams
+	if err := json.Unmarshal(req.Params, &params); err != nil || params.Topic == "" {
+		c.conn.send(rpcResponse{JSONRPC: "2.0", ID: req.ID, Error: &rpcError{Code: -32602, Message: "invalid params"}})
+		return
+	}
+
+	topic, err := c.resolveTopic(params.Topic)
+	if err != nil {
+		c.conn.send(rpcResponse{JSONRPC: "2.0", ID: req.ID, Error: &rpcError{Code: -32602, Message: err.Error()}})
+		return
+	}
+
+	if c.server.limiter != nil && !c.server.limiter.AllowSubscribe(c.userID) {
+		c.conn.send(rpcResponse{JSONRPC: "2.0", ID: req.ID, Error: &rpcError{Code: quota.ErrRateLimited, Message: "too many open subscriptions"}})
+		return
+	}
+
+	id := newSubscriptionID()
+	c.server.hub.add(topic, &subscription{id: id, topic: topic, conn: c.conn})
+	c.subs[id] = topic
+	c.conn.send(rpcResponse{JSONRPC: "2.0", ID: req.ID, Result: id})
+}
+
+func (c *client) handleUnsubscribe(req rpcRequest) {
+	var params unsubscribeParams
+	if err := json.Unmarshal(req.Params, &params); err != nil || params.Subscription == "" {
+		c.conn.send(rpcResponse{JSONRPC: "2.0", ID: req.ID, Error: &rpcError{Code: -32602, Message: "invalid params"}})
+		return
+	}
+
+	topic, ok := c.subs[params.Subscription]
+	if !ok {
+		c.conn.send(rpcResponse{JSONRPC: "2.0", ID: req.ID, Result: false})
+		return
+	}
+
+	c.server.hub.remove(topic, params.Subscription)
+	delete(c.subs, params.Subscription)
+	if c.server.limiter != nil {
+		c.server.limiter.ReleaseSubscribe(c.userID)
+	}
+	c.conn.send(rpcResponse{JSONRPC: "2.0", ID: req.ID, Result: true})
+}
+
+// resolveTopic validates the requested topic and, for account.{userID},
+// requires it to name the caller's own ID, so one client can't snoop on
+// another user's balance changes by guessing their topic.
+func (c *client) resolveTopic(requested string) (Topic, error) {
+	switch {
+	case requested == string(TopicNewBlocks):
+		return TopicNewBlocks, nil
+	case strings.HasPrefix(requested, "account."):
+		userID := strings.TrimPrefix(requested, "account.")
+		if userID != c.userID {
+			return "", errors.New("cannot subscribe to another user's account topic")
+		}
+		return accountTopic(userID), nil
+	case strings.HasPrefix(requested, "tx."):
+		return Topic(requested), nil
+	default:
+		return "", errors.New("unknown topic")
+	}
+}
+
+func (c *client) close() {
+	for id, topic := range c.subs {
+		c.server.hub.remove(topic, id)
+		if c.server.limiter != nil {
+			c.server.limiter.ReleaseSubscribe(c.userID)
+		}
+	}
+	c.conn.ws.Close()
+}
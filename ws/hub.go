@@ -0,0 +1,53 @@
+package ws
+
+import "sync"
+
+// Topic identifies a stream of events a client can subscribe to: newBlocks,
+// account.<userID>, or tx.<hash>.
+type Topic string
+
+// TopicNewBlocks fires once per block committed by the theta node.
+const TopicNewBlocks = Topic("newBlocks")
+
+func accountTopic(userID string) Topic { return Topic("account." + userID) }
+func txTopic(hash string) Topic        { return Topic("tx." + hash) }
+
+// hub fans upstream events out to every client subscribed to a topic. A
+// topic with no subscribers is simply never looked up, so there is no need
+// to subscribe/unsubscribe from the upstream node per topic.
+type hub struct {
+	mu   sync.Mutex
+	subs map[Topic]map[string]*subscription
+}
+
+func newHub() *hub {
+	return &hub{subs: map[Topic]map[string]*subscription{}}
+}
+
+func (h *hub) add(topic Topic, sub *subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subs[topic] == nil {
+		h.subs[topic] = map[string]*subscription{}
+	}
+	h.subs[topic][sub.id] = sub
+}
+
+func (h *hub) remove(topic Topic, id string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.subs[topic], id)
+}
+
+func (h *hub) publish(topic Topic, result interface{}) {
+	h.mu.Lock()
+	subs := make([]*subscription, 0, len(h.subs[topic]))
+	for _, s := range h.subs[topic] {
+		subs = append(subs, s)
+	}
+	h.mu.Unlock()
+
+	for _, s := range subs {
+		s.deliver(result)
+	}
+}
@@ -0,0 +1,74 @@
+// Package ws serves a JSON-RPC 2.0 subscription endpoint (/ws) alongside the
+// vault's request/response /rpc endpoint, so clients can stream newBlocks,
+// account balance/sequence changes, and tx delivery confirmations instead of
+// polling theta.GetAccount.
+package ws
+
+import (
+	"net/http"
+
+	"github.com/gorilla/websocket"
+	log "github.com/sirupsen/logrus"
+
+	vault "github.com/thetatoken/vault"
+	"github.com/thetatoken/vault/quota"
+)
+
+// Server upgrades authenticated HTTP connections to websockets and
+// multiplexes upstream theta node events onto each client's subscriptions.
+type Server struct {
+	km       vault.KeyManager
+	limiter  *quota.Limiter
+	hub      *hub
+	upstream *upstream
+	logger   *log.Entry
+	upgrader websocket.Upgrader
+}
+
+// NewServer starts forwarding events from the theta node at upstreamAddr
+// (its Tendermint event bus, e.g. "ws://localhost:16888/websocket") in the
+// background and returns a Server ready to be mounted at /ws. km is used to
+// resolve the chain addresses upstream events are keyed by back to the
+// vault userid that owns them, so account.{userID} subscriptions fire.
+func NewServer(km vault.KeyManager, limiter *quota.Limiter, upstreamAddr string) *Server {
+	logger := log.WithFields(log.Fields{"component": "ws"})
+	h := newHub()
+
+	s := &Server{
+		km:      km,
+		limiter: limiter,
+		hub:     h,
+		logger:  logger,
+		// The vault gates access with X-Auth-User, not browser same-origin
+		// policy, so accept upgrades from any origin.
+		upgrader: websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }},
+	}
+	s.upstream = newUpstream(upstreamAddr, h, km, logger)
+	go s.upstream.run()
+	return s
+}
+
+// ServeHTTP identifies the caller by the same X-Auth-User header /rpc reads,
+// rejecting the upgrade if it is missing, and then hands the connection off
+// to a client's read loop.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("X-Auth-User")
+	if userID == "" {
+		http.Error(w, "X-Auth-User header required", http.StatusUnauthorized)
+		return
+	}
+
+	wsConn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to upgrade websocket connection")
+		return
+	}
+
+	c := &client{
+		userID: userID,
+		conn:   &conn{ws: wsConn},
+		server: s,
+		subs:   map[string]Topic{},
+	}
+	c.run()
+}
@@ -0,0 +1,57 @@
+package ws
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// subscription is one client's open stream for a single topic.
+type subscription struct {
+	id    string
+	topic Topic
+	conn  *conn
+}
+
+func (s *subscription) deliver(result interface{}) {
+	s.conn.send(subscriptionNotification{
+		JSONRPC: "2.0",
+		Method:  "theta.Subscription",
+		Params: subscriptionParams{
+			Subscription: s.id,
+			Result:       result,
+		},
+	})
+}
+
+type subscriptionNotification struct {
+	JSONRPC string             `json:"jsonrpc"`
+	Method  string             `json:"method"`
+	Params  subscriptionParams `json:"params"`
+}
+
+type subscriptionParams struct {
+	Subscription string      `json:"subscription"`
+	Result       interface{} `json:"result"`
+}
+
+// conn serializes writes to a single websocket connection; gorilla/websocket
+// connections are not safe for concurrent writers.
+type conn struct {
+	ws *websocket.Conn
+	mu sync.Mutex
+}
+
+func (c *conn) send(v interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ws.WriteJSON(v)
+}
+
+func newSubscriptionID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,121 @@
+package ws
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gorilla/websocket"
+	log "github.com/sirupsen/logrus"
+
+	vault "github.com/thetatoken/vault"
+)
+
+// upstream maintains a websocket connection to the theta node's own event
+// bus and republishes NewBlock and Tx events onto the hub's topics.
+type upstream struct {
+	addr   string
+	hub    *hub
+	km     vault.KeyManager
+	logger *log.Entry
+}
+
+func newUpstream(addr string, h *hub, km vault.KeyManager, logger *log.Entry) *upstream {
+	return &upstream{addr: addr, hub: h, km: km, logger: logger}
+}
+
+type tmEventEnvelope struct {
+	ID     string `json:"id"`
+	Result struct {
+		Data json.RawMessage `json:"data"`
+	} `json:"result"`
+}
+
+type txEventData struct {
+	TxHash   string   `json:"hash"`
+	Accounts []string `json:"accounts"`
+}
+
+// run dials the upstream node and re-subscribes whenever the connection
+// drops, so a node restart doesn't permanently wedge the vault's own
+// subscribers.
+func (u *upstream) run() {
+	for {
+		if err := u.connectAndForward(); err != nil {
+			u.logger.WithError(err).Warn("Lost connection to upstream event bus, retrying")
+		}
+		time.Sleep(5 * time.Second)
+	}
+}
+
+func (u *upstream) connectAndForward() error {
+	conn, _, err := websocket.DefaultDialer.Dial(u.addr, nil)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	subscriptions := []string{
+		`{"jsonrpc":"2.0","id":"newBlocks","method":"subscribe","params":{"query":"tm.event='NewBlock'"}}`,
+		`{"jsonrpc":"2.0","id":"tx","method":"subscribe","params":{"query":"tm.event='Tx'"}}`,
+	}
+	for _, sub := range subscriptions {
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(sub)); err != nil {
+			return err
+		}
+	}
+
+	for {
+		_, raw, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		u.dispatch(raw)
+	}
+}
+
+func (u *upstream) dispatch(raw []byte) {
+	var envelope tmEventEnvelope
+	if err := json.Unmarshal(raw, &envelope); err != nil {
+		return
+	}
+
+	switch envelope.ID {
+	case "newBlocks":
+		u.hub.publish(TopicNewBlocks, envelope.Result.Data)
+	case "tx":
+		u.dispatchTx(envelope.Result.Data)
+	}
+}
+
+// dispatchTx forwards a Tx event to its tx.{hash} topic and to every
+// affected account's topic, so a Send caller and the account holder both
+// see delivery without the vault having to track which tx belongs to whom.
+// account.{userID} topics are keyed by vault userid, not chain address, so
+// each affected address is first resolved back to its owning userid via km.
+func (u *upstream) dispatchTx(data json.RawMessage) {
+	var tx txEventData
+	if err := json.Unmarshal(data, &tx); err != nil {
+		return
+	}
+	if tx.TxHash != "" {
+		u.hub.publish(txTopic(tx.TxHash), data)
+	}
+	for _, topic := range u.accountTopicsFor(tx.Accounts) {
+		u.hub.publish(topic, data)
+	}
+}
+
+// accountTopicsFor resolves each chain address in accounts back to its
+// owning userid's topic via km, silently dropping addresses the vault
+// doesn't manage (e.g. the external counterparty of a Send).
+func (u *upstream) accountTopicsFor(accounts []string) []Topic {
+	topics := make([]Topic, 0, len(accounts))
+	for _, account := range accounts {
+		record, err := u.km.FindByAddress(account)
+		if err != nil {
+			continue
+		}
+		topics = append(topics, accountTopic(record.UserID))
+	}
+	return topics
+}
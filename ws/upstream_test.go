@@ -0,0 +1,77 @@
+package ws
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	vault "github.com/thetatoken/vault"
+)
+
+// fakeKeyManager implements vault.KeyManager backed by a plain address ->
+// userid map; only FindByAddress is exercised by these tests.
+type fakeKeyManager struct {
+	byAddress map[string]string
+}
+
+func (f *fakeKeyManager) Close() {}
+
+func (f *fakeKeyManager) FindByUserId(userid string, path ...string) (vault.Record, error) {
+	return vault.Record{}, vault.ErrRecordNotFound
+}
+
+func (f *fakeKeyManager) FindByAddress(address string) (vault.Record, error) {
+	userID, ok := f.byAddress[address]
+	if !ok {
+		return vault.Record{}, vault.ErrRecordNotFound
+	}
+	return vault.Record{UserID: userID, Address: address}, nil
+}
+
+func (f *fakeKeyManager) Create(r vault.Record) error { return fmt.Errorf("not implemented") }
+
+func (f *fakeKeyManager) Unlock(userid, passphrase string) (vault.Record, error) {
+	return vault.Record{}, vault.ErrRecordNotFound
+}
+
+func (f *fakeKeyManager) ChangePassphrase(userid, oldPassphrase, newPassphrase string) error {
+	return fmt.Errorf("not implemented")
+}
+
+func (f *fakeKeyManager) ExportMnemonic(userid, passphrase string) (string, error) {
+	return "", fmt.Errorf("not implemented")
+}
+
+func (f *fakeKeyManager) ImportMnemonic(userid string, words []string, passphrase string) error {
+	return fmt.Errorf("not implemented")
+}
+
+func (f *fakeKeyManager) DeriveSubaccount(userid, passphrase, path string) (vault.Record, error) {
+	return vault.Record{}, fmt.Errorf("not implemented")
+}
+
+// TestAccountTopicsForResolvesAddressToUserID is the regression case for
+// account.{userID} subscriptions never firing: events must be published
+// under the owning userid's topic, not the raw chain address they arrived
+// keyed by.
+func TestAccountTopicsForResolvesAddressToUserID(t *testing.T) {
+	assert := assert.New(t)
+
+	km := &fakeKeyManager{byAddress: map[string]string{"deadbeef": "alice"}}
+	u := &upstream{km: km}
+
+	topics := u.accountTopicsFor([]string{"deadbeef"})
+	assert.Equal([]Topic{accountTopic("alice")}, topics)
+	assert.NotContains(topics, accountTopic("deadbeef"))
+}
+
+func TestAccountTopicsForSkipsUnknownAddress(t *testing.T) {
+	assert := assert.New(t)
+
+	km := &fakeKeyManager{byAddress: map[string]string{}}
+	u := &upstream{km: km}
+
+	topics := u.accountTopicsFor([]string{"not-ours"})
+	assert.Empty(topics)
+}